@@ -0,0 +1,470 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	apiPrefix   = "/api/v1"
+	yamlContent = "application/x-yaml"
+)
+
+// Client talks to the REST API of a running otlpinf instance, either over TCP or
+// through the unix socket it listens on.
+type Client struct {
+	http    *http.Client
+	baseURL string
+	token   string
+	author  string
+}
+
+type errorValue struct {
+	Message string `json:"message"`
+}
+
+// StatusError is returned when otlpinf replies with an error status code.
+type StatusError struct {
+	Method  string
+	Path    string
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.Code, e.Message)
+}
+
+func New(host string, port uint64, socket string, token string) *Client {
+	c := &Client{
+		http:    &http.Client{Timeout: 30 * time.Second},
+		baseURL: "http://" + net.JoinHostPort(host, strconv.FormatUint(port, 10)),
+		token:   token,
+	}
+	if socket != "" {
+		c.http.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		c.baseURL = "http://otlpinf"
+	}
+	return c
+}
+
+// EnableTLS switches the client to https, trusting caFile in addition to the system roots.
+func (c *Client) EnableTLS(caFile string, insecure bool) error {
+	conf := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			return errors.New("no certificate found in " + caFile)
+		}
+		conf.RootCAs = pool
+	}
+	transport, ok := c.http.Transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	transport.TLSClientConfig = conf
+	c.http.Transport = transport
+	c.baseURL = "https" + strings.TrimPrefix(c.baseURL, "http")
+	return nil
+}
+
+// SetAuthor sets the name recorded in the revisions of the policies changed by the client.
+func (c *Client) SetAuthor(author string) {
+	c.author = author
+}
+
+func (c *Client) Status() (map[string]interface{}, error) {
+	var ret map[string]interface{}
+	err := c.getJSON("/status", &ret)
+	return ret, err
+}
+
+func (c *Client) Capabilities() (map[string]interface{}, error) {
+	var ret map[string]interface{}
+	err := c.getJSON("/capabilities", &ret)
+	return ret, err
+}
+
+// Collectors returns the collector distributions policies can select, with their versions and components.
+func (c *Client) Collectors() ([]map[string]interface{}, error) {
+	var ret []map[string]interface{}
+	err := c.getJSON("/collectors", &ret)
+	return ret, err
+}
+
+// UploadCollector uploads a collector binary, which otlpinf checks against its hex SHA-256 and
+// signature, if any, and registers as name, or as its version when name is empty.
+func (c *Client) UploadCollector(name string, binary io.Reader, sha256 string, signature []byte) (map[string]interface{}, error) {
+	q := url.Values{}
+	q.Set("sha256", sha256)
+	if name != "" {
+		q.Set("name", name)
+	}
+	if signature != nil {
+		q.Set("signature", base64.StdEncoding.EncodeToString(signature))
+	}
+	body, err := c.send(c.untimed(), http.MethodPost, "/collectors?"+q.Encode(), "application/octet-stream", binary)
+	if err != nil {
+		return nil, err
+	}
+	var ret map[string]interface{}
+	err = json.Unmarshal(body, &ret)
+	return ret, err
+}
+
+// MigrateCollector restarts the policies matching a label selector and a comma separated list of
+// statuses, all of them when both are empty, on the collector one after the other.
+func (c *Client) MigrateCollector(name string, selector string, status string) (map[string]interface{}, error) {
+	q := url.Values{}
+	q.Set("selector", selector)
+	if status != "" {
+		q.Set("status", status)
+	}
+	body, err := c.send(c.untimed(), http.MethodPost, "/collectors/"+url.PathEscape(name)+"/migrate?"+q.Encode(), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var ret map[string]interface{}
+	err = json.Unmarshal(body, &ret)
+	return ret, err
+}
+
+func (c *Client) ListPolicies() ([]string, error) {
+	var ret []string
+	err := c.getJSON("/policies", &ret)
+	return ret, err
+}
+
+// QueryPolicies returns a page of the policies matching a label selector and a comma separated
+// list of statuses. An empty cont requests the first page and a zero limit returns every policy.
+func (c *Client) QueryPolicies(selector string, status string, limit int, cont string) (map[string]interface{}, error) {
+	q := url.Values{}
+	q.Set("selector", selector)
+	if status != "" {
+		q.Set("status", status)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	if cont != "" {
+		q.Set("continue", cont)
+	}
+	var ret map[string]interface{}
+	err := c.getJSON("/policies?"+q.Encode(), &ret)
+	return ret, err
+}
+
+// DeletePolicies deletes the policies matching a label selector and statuses, returning their names.
+func (c *Client) DeletePolicies(selector string, status string) ([]string, error) {
+	q := url.Values{}
+	q.Set("selector", selector)
+	if status != "" {
+		q.Set("status", status)
+	}
+	body, err := c.do(http.MethodDelete, "/policies?"+q.Encode(), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	err = json.Unmarshal(body, &ret)
+	return ret, err
+}
+
+// GetPolicy returns the policy definition and its runner state keyed by policy name.
+func (c *Client) GetPolicy(name string) (map[string]interface{}, error) {
+	body, err := c.do(http.MethodGet, "/policies/"+url.PathEscape(name), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var ret map[string]interface{}
+	if err = yaml.Unmarshal(body, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ApplyPolicy sends a policy file in the `map[string]config.Policy` format to otlpinf, updating
+// the policy when it already exists.
+func (c *Client) ApplyPolicy(policy []byte) (map[string]interface{}, error) {
+	body, err := c.do(http.MethodPost, "/policies", yamlContent, strings.NewReader(string(policy)))
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusConflict {
+		var names map[string]interface{}
+		if yaml.Unmarshal(policy, &names) == nil && len(names) == 1 {
+			for name := range names {
+				body, err = c.do(http.MethodPut, "/policies/"+url.PathEscape(name), yamlContent, strings.NewReader(string(policy)))
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ret map[string]interface{}
+	if err = yaml.Unmarshal(body, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (c *Client) DeletePolicy(name string) (string, error) {
+	body, err := c.do(http.MethodDelete, "/policies/"+url.PathEscape(name), "", nil)
+	if err != nil {
+		return "", err
+	}
+	var ret errorValue
+	if err = json.Unmarshal(body, &ret); err != nil {
+		return "", err
+	}
+	return ret.Message, nil
+}
+
+func (c *Client) PolicyLogs(name string, tail int) ([]string, error) {
+	path := "/policies/" + url.PathEscape(name) + "/logs"
+	if tail > 0 {
+		path += "?tail=" + strconv.Itoa(tail)
+	}
+	var ret []string
+	err := c.getJSON(path, &ret)
+	return ret, err
+}
+
+// PolicyStats returns the resources used by the collector process of a policy.
+func (c *Client) PolicyStats(name string) (map[string]interface{}, error) {
+	var ret map[string]interface{}
+	err := c.getJSON("/policies/"+url.PathEscape(name)+"/stats", &ret)
+	return ret, err
+}
+
+// PausePolicy stops the collector of a policy, keeping its definition.
+func (c *Client) PausePolicy(name string) (map[string]interface{}, error) {
+	return c.policyAction(name, "pause")
+}
+
+// ResumePolicy starts again the collector of a paused policy.
+func (c *Client) ResumePolicy(name string) (map[string]interface{}, error) {
+	return c.policyAction(name, "resume")
+}
+
+func (c *Client) RestartPolicy(name string) (map[string]interface{}, error) {
+	return c.policyAction(name, "restart")
+}
+
+// ProbePolicy sends synthetic telemetry to the OTLP receivers of a policy and returns whether
+// they accepted it.
+func (c *Client) ProbePolicy(name string) (map[string]interface{}, error) {
+	body, err := c.do(http.MethodPost, "/policies/"+url.PathEscape(name)+"/probe", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var ret map[string]interface{}
+	err = json.Unmarshal(body, &ret)
+	return ret, err
+}
+
+func (c *Client) policyAction(name string, action string) (map[string]interface{}, error) {
+	body, err := c.do(http.MethodPost, "/policies/"+url.PathEscape(name)+"/"+action, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var ret map[string]interface{}
+	if err = yaml.Unmarshal(body, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Revisions lists the revisions kept for a policy, without their definitions.
+func (c *Client) Revisions(name string) ([]map[string]interface{}, error) {
+	var ret []map[string]interface{}
+	err := c.getJSON("/policies/"+url.PathEscape(name)+"/revisions", &ret)
+	return ret, err
+}
+
+// DiffRevisions returns the unified diff from a revision to another, or to the latest one when to is 0.
+func (c *Client) DiffRevisions(name string, from int64, to int64) (string, error) {
+	path := "/policies/" + url.PathEscape(name) + "/revisions/" + strconv.FormatInt(from, 10) + "/diff"
+	if to > 0 {
+		path += "?to=" + strconv.FormatInt(to, 10)
+	}
+	body, err := c.do(http.MethodGet, path, "", nil)
+	return string(body), err
+}
+
+// Rollback applies again the definition a policy had at the given revision.
+func (c *Client) Rollback(name string, to int64) (map[string]interface{}, error) {
+	body, err := c.do(http.MethodPost, "/policies/"+url.PathEscape(name)+"/rollback?to="+strconv.FormatInt(to, 10), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var ret map[string]interface{}
+	if err = yaml.Unmarshal(body, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Events calls handle with every event sent by otlpinf, for the given comma separated policies
+// or for all of them when empty, until ctx is done, the stream ends or handle fails.
+func (c *Client) Events(ctx context.Context, policy string, handle func(event map[string]interface{}) error) error {
+	path := "/events"
+	if policy != "" {
+		path += "?policy=" + url.QueryEscape(policy)
+	}
+	return c.stream(ctx, path, func(_ string, data []byte) error {
+		var event map[string]interface{}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		return handle(event)
+	})
+}
+
+// Tap restarts the collector of a policy exporting a pipeline to otlpinf as well, and calls handle
+// with the name and JSON data of every event of the tap: tap when it starts, then the signal for
+// every sampled OTLP JSON request, and end if the policy changes. The pipeline is selected by its
+// name or else by its signal, and at most rate requests are sent every second, the otlpinf default
+// when 0. The collector is restarted without the tap once ctx is done.
+func (c *Client) Tap(ctx context.Context, policy string, signal string, pipeline string, rate int, handle func(event string, data json.RawMessage) error) error {
+	q := url.Values{}
+	if signal != "" {
+		q.Set("signal", signal)
+	}
+	if pipeline != "" {
+		q.Set("pipeline", pipeline)
+	}
+	if rate > 0 {
+		q.Set("rate", strconv.Itoa(rate))
+	}
+	return c.stream(ctx, "/policies/"+url.PathEscape(policy)+"/tap?"+q.Encode(), func(event string, data []byte) error {
+		return handle(event, data)
+	})
+}
+
+// stream calls handle with the name and data of every server-sent event of path until ctx is
+// done, the stream ends or handle fails.
+func (c *Client) stream(ctx context.Context, path string, handle func(event string, data []byte) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+apiPrefix+path, nil)
+	if err != nil {
+		return err
+	}
+	c.setHeaders(req)
+	// the stream lasts until it is cancelled, so the client timeout does not apply
+	resp, err := c.untimed().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		var e errorValue
+		if json.NewDecoder(resp.Body).Decode(&e) != nil || e.Message == "" {
+			e.Message = resp.Status
+		}
+		return &StatusError{Method: http.MethodGet, Path: path, Code: resp.StatusCode, Message: e.Message}
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	// telemetry batches are larger than the default line limit
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	event := ""
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(scanner.Text(), "event:"); ok {
+			event = name
+			continue
+		}
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		if err = handle(event, []byte(data)); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+func (c *Client) getJSON(path string, v interface{}) error {
+	body, err := c.do(http.MethodGet, path, "", nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (c *Client) setHeaders(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.author != "" {
+		req.Header.Set("X-Otlpinf-Author", c.author)
+	}
+}
+
+func (c *Client) do(method string, path string, contentType string, body io.Reader) ([]byte, error) {
+	return c.send(c.http, method, path, contentType, body)
+}
+
+// untimed returns a copy of the HTTP client without timeout, for requests lasting as long as
+// otlpinf needs to handle them.
+func (c *Client) untimed() *http.Client {
+	hc := *c.http
+	hc.Timeout = 0
+	return &hc
+}
+
+func (c *Client) send(hc *http.Client, method string, path string, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, c.baseURL+apiPrefix+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c.setHeaders(req)
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	ret, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var e errorValue
+		if json.Unmarshal(ret, &e) != nil || e.Message == "" {
+			e.Message = strings.TrimSpace(string(ret))
+		}
+		return nil, &StatusError{Method: method, Path: path, Code: resp.StatusCode, Message: e.Message}
+	}
+	return ret, nil
+}
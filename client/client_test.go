@@ -0,0 +1,214 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	ERROR_MSG   = "Expected no error, but got %v"
+	TEST_POLICY = "test-policy"
+	TEST_TOKEN  = "token"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	port, err := strconv.ParseUint(u.Port(), 10, 64)
+	if err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	return New(u.Hostname(), port, "", TEST_TOKEN)
+}
+
+func TestClientListPolicies(t *testing.T) {
+	// Arrange
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+TEST_TOKEN {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/api/v1/policies" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`["` + TEST_POLICY + `"]`))
+	})
+
+	// Act
+	policies, err := c.ListPolicies()
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if len(policies) != 1 || policies[0] != TEST_POLICY {
+		t.Errorf("Expected policies to be [%s], got %v", TEST_POLICY, policies)
+	}
+}
+
+func TestClientApplyPolicy(t *testing.T) {
+	// Arrange
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != yamlContent {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(TEST_POLICY + ":\n  status:\n    status: running\n"))
+	})
+
+	// Act
+	p, err := c.ApplyPolicy([]byte(TEST_POLICY + ":\n  config: {}\n"))
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if _, ok := p[TEST_POLICY]; !ok {
+		t.Errorf("Expected %s in response, got %v", TEST_POLICY, p)
+	}
+}
+
+func TestClientApplyExistingPolicy(t *testing.T) {
+	// Arrange
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"message": "policy already exists"}`))
+			return
+		}
+		if r.URL.Path != "/api/v1/policies/"+TEST_POLICY || r.Header.Get("X-Otlpinf-Author") != "tester" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(TEST_POLICY + ":\n  status:\n    status: running\n"))
+	})
+	c.SetAuthor("tester")
+
+	// Act
+	p, err := c.ApplyPolicy([]byte(TEST_POLICY + ":\n  config: {}\n"))
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if _, ok := p[TEST_POLICY]; !ok {
+		t.Errorf("Expected %s in response, got %v", TEST_POLICY, p)
+	}
+}
+
+func TestClientEvents(t *testing.T) {
+	// Arrange
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("policy") != TEST_POLICY {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte("event:created\ndata:{\"type\":\"created\",\"policy\":\"" + TEST_POLICY + "\"}\n\n: keep-alive\n\n"))
+	})
+	received := make([]map[string]interface{}, 0)
+
+	// Act
+	err := c.Events(context.Background(), TEST_POLICY, func(e map[string]interface{}) error {
+		received = append(received, e)
+		return nil
+	})
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if len(received) != 1 || received[0]["type"] != "created" {
+		t.Errorf("Expected a created event, got %v", received)
+	}
+}
+
+func TestClientTap(t *testing.T) {
+	// Arrange
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("signal") != "logs" || r.URL.Query().Get("rate") != "5" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"message":"policy has no logs pipeline"}`))
+			return
+		}
+		_, _ = w.Write([]byte("event:tap\ndata:{\"pipeline\":\"logs\"}\n\nevent:logs\ndata:{\"resourceLogs\":[]}\n\n"))
+	})
+	received := make([]string, 0)
+
+	// Act
+	err := c.Tap(context.Background(), TEST_POLICY, "logs", "", 5, func(event string, data json.RawMessage) error {
+		received = append(received, event+" "+string(data))
+		return nil
+	})
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if len(received) != 2 || received[1] != `logs {"resourceLogs":[]}` {
+		t.Errorf("Expected the tap and logs events, got %v", received)
+	}
+
+	// Act
+	err = c.Tap(context.Background(), TEST_POLICY, "traces", "", 5, func(string, json.RawMessage) error { return nil })
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "policy has no logs pipeline") {
+		t.Errorf("Expected the otlpinf error message, got %v", err)
+	}
+}
+
+func TestClientUploadCollector(t *testing.T) {
+	// Arrange
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		q := r.URL.Query()
+		if r.URL.Path != "/api/v1/collectors" || q.Get("sha256") != "abc" || q.Get("signature") != "c2ln" || string(body) != "otelcol" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"name": "0.100.0", "sha256": "abc"}`))
+	})
+
+	// Act
+	collector, err := c.UploadCollector("", strings.NewReader("otelcol"), "abc", []byte("sig"))
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if collector["name"] != "0.100.0" {
+		t.Errorf("Expected collector 0.100.0, got %v", collector)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	// Arrange
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message": "policy not found"}`))
+	})
+
+	// Act
+	_, err := c.GetPolicy(TEST_POLICY)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an error, but got none")
+	} else if !strings.Contains(err.Error(), "policy not found") {
+		t.Errorf("Expected a 'policy not found' error, but got: %s", err.Error())
+	}
+}
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/leoparente/opentelemetry-infinity/client"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	Output      string
+	PolicyFile  string
+	LogsTail    int
+	RevisionTo  int64
+	Selector    string
+	StatusQuery string
+	TLS         bool
+	TLSCAFile   string
+	TLSInsecure bool
+)
+
+var componentKinds = []string{"receivers", "processors", "exporters", "connectors", "extensions"}
+
+func newClient() (*client.Client, error) {
+	c := client.New(ServerHost, ServerPort, ServerSocket, ServerToken)
+	c.SetAuthor(os.Getenv("USER"))
+	if TLS || TLSCAFile != "" || TLSInsecure {
+		if err := c.EnableTLS(TLSCAFile, TLSInsecure); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func addClientFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVarP(&ServerHost, "server_host", "a", "localhost", "otlpinf REST Host")
+	cmd.PersistentFlags().Uint64VarP(&ServerPort, "server_port", "p", 10222, "otlpinf REST Port")
+	cmd.PersistentFlags().StringVar(&ServerSocket, "server_socket", "", "otlpinf unix socket. Takes precedence over host and port")
+	cmd.PersistentFlags().StringVar(&ServerToken, "token", os.Getenv("OTLPINF_AUTH_TOKEN"), "Bearer token used to authenticate against otlpinf")
+	cmd.PersistentFlags().BoolVar(&TLS, "tls", false, "Connect to otlpinf over TLS")
+	cmd.PersistentFlags().StringVar(&TLSCAFile, "tls_ca_file", "", "CA used to verify the otlpinf certificate. Implies --tls")
+	cmd.PersistentFlags().BoolVar(&TLSInsecure, "tls_insecure", false, "Skip otlpinf certificate verification. Implies --tls")
+	cmd.PersistentFlags().StringVarP(&Output, "output", "o", "table", "Output format: table, yaml or json")
+}
+
+// printOutput writes v as yaml or json, or calls table to render it in the table format.
+func printOutput(v interface{}, table func(w *tabwriter.Writer)) error {
+	switch Output {
+	case "json":
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case "yaml":
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(b))
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		table(w)
+		return w.Flush()
+	default:
+		return fmt.Errorf("invalid output format %q, use table, yaml or json", Output)
+	}
+	return nil
+}
+
+// policyState extracts the runner state from a policy returned by the REST API.
+func policyState(policy interface{}) map[string]interface{} {
+	p, ok := policy.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	s, _ := p["status"].(map[string]interface{})
+	return s
+}
+
+func newStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the runtime status of a running opentelemetry-infinity",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			status, err := c.Status()
+			if err != nil {
+				return err
+			}
+			return printOutput(status, func(w *tabwriter.Writer) {
+				keys := make([]string, 0, len(status))
+				for k := range status {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					fmt.Fprintf(w, "%s\t%v\n", k, status[k])
+				}
+			})
+		},
+	}
+	addClientFlags(cmd)
+	return cmd
+}
+
+func newCapabilitiesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "capabilities",
+		Short: "List the components available in the collector of a running opentelemetry-infinity",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			caps, err := c.Capabilities()
+			if err != nil {
+				return err
+			}
+			return printOutput(caps, func(w *tabwriter.Writer) {
+				fmt.Fprintln(w, "KIND\tNAME")
+				for _, kind := range componentKinds {
+					components, _ := caps[kind].([]interface{})
+					for _, c := range components {
+						if m, ok := c.(map[string]interface{}); ok {
+							fmt.Fprintf(w, "%s\t%v\n", kind, m["name"])
+						}
+					}
+				}
+			})
+		},
+	}
+	addClientFlags(cmd)
+	return cmd
+}
+
+func newCollectorsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "collectors",
+		Short: "List the collector distributions policies of a running opentelemetry-infinity can select",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			collectors, err := c.Collectors()
+			if err != nil {
+				return err
+			}
+			return printOutput(collectors, func(w *tabwriter.Writer) {
+				fmt.Fprintln(w, "NAME\tVERSION\tDEFAULT\tBINARY")
+				for _, collector := range collectors {
+					binary := collector["binary"]
+					if binary == nil {
+						binary = "embedded"
+					}
+					fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", collector["name"], collector["version"], collector["default"], binary)
+				}
+			})
+		},
+	}
+
+	var name, signatureFile string
+	uploadCmd := &cobra.Command{
+		Use:   "upload -f BINARY",
+		Short: "Upload a collector binary, named after its version unless --name is given",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(PolicyFile)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			h := sha256.New()
+			if _, err = io.Copy(h, f); err != nil {
+				return err
+			}
+			if _, err = f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			var signature []byte
+			if signatureFile != "" {
+				if signature, err = os.ReadFile(signatureFile); err != nil {
+					return err
+				}
+			}
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			collector, err := c.UploadCollector(name, f, hex.EncodeToString(h.Sum(nil)), signature)
+			if err != nil {
+				return err
+			}
+			return printOutput(collector, func(w *tabwriter.Writer) {
+				fmt.Fprintln(w, "NAME\tVERSION\tSHA256")
+				fmt.Fprintf(w, "%v\t%v\t%v\n", collector["name"], collector["version"], collector["sha256"])
+			})
+		},
+	}
+	uploadCmd.Flags().StringVarP(&PolicyFile, "file", "f", "", "Collector executable to upload")
+	uploadCmd.Flags().StringVar(&name, "name", "", "Name policies select the collector with")
+	uploadCmd.Flags().StringVar(&signatureFile, "signature_file", "", "Binary signature of the SHA-256 of the executable, e.g. by openssl dgst -sha256 -sign")
+	cobra.CheckErr(uploadCmd.MarkFlagRequired("file"))
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate COLLECTOR",
+		Short: "Restart policies on a collector one after the other, stopping at the first failure",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			migration, err := c.MigrateCollector(args[0], Selector, StatusQuery)
+			if err != nil {
+				return err
+			}
+			return printOutput(migration, func(w *tabwriter.Writer) {
+				fmt.Fprintln(w, "RESULT\tPOLICIES")
+				for _, result := range []string{"migrated", "skipped"} {
+					fmt.Fprintf(w, "%s\t%v\n", result, migration[result])
+				}
+			})
+		},
+	}
+	migrateCmd.Flags().StringVarP(&Selector, "selector", "l", "", "Migrate the policies matching this label selector")
+	migrateCmd.Flags().StringVar(&StatusQuery, "status", "", "Migrate the policies in these comma separated statuses")
+
+	cmd.AddCommand(uploadCmd, migrateCmd)
+	addClientFlags(cmd)
+	return cmd
+}
+
+func newEventsCmd() *cobra.Command {
+	var policy string
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Follow the policy events of a running opentelemetry-infinity",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+			return c.Events(ctx, policy, func(e map[string]interface{}) error {
+				if Output == "table" {
+					fmt.Printf("%v\t%v\t%v\t%v -> %v\t%v\n", e["timestamp"], e["type"], e["policy"], e["old_status"], e["new_status"], e["error"])
+					return nil
+				}
+				// every event is printed on its own, so yaml and json streams can be split by line or document
+				if Output == "yaml" {
+					fmt.Println("---")
+				}
+				return printOutput(e, nil)
+			})
+		},
+	}
+	addClientFlags(cmd)
+	cmd.Flags().StringVar(&policy, "policy", "", "Comma separated policies to follow (defaults to all)")
+	return cmd
+}
+
+func newPoliciesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "policies",
+		Short: "Manage policies of a running opentelemetry-infinity",
+	}
+	addClientFlags(cmd)
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all policies and their status",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			if Selector != "" || StatusQuery != "" {
+				page, err := c.QueryPolicies(Selector, StatusQuery, 0, "")
+				if err != nil {
+					return err
+				}
+				return printOutput(page, func(w *tabwriter.Writer) {
+					fmt.Fprintln(w, "NAME\tSTATUS\tOWNER\tRESTARTS\tLAST ERROR")
+					items, _ := page["items"].([]interface{})
+					for _, i := range items {
+						p, _ := i.(map[string]interface{})
+						fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", p["name"], p["status"], p["owner"], p["restart_count"], p["last_error"])
+					}
+				})
+			}
+			names, err := c.ListPolicies()
+			if err != nil {
+				return err
+			}
+			sort.Strings(names)
+			policies := make(map[string]interface{}, len(names))
+			for _, name := range names {
+				p, err := c.GetPolicy(name)
+				if err != nil {
+					return err
+				}
+				policies[name] = p[name]
+			}
+			return printOutput(policies, func(w *tabwriter.Writer) {
+				fmt.Fprintln(w, "NAME\tSTATUS\tRESTARTS\tLAST ERROR")
+				for _, name := range names {
+					s := policyState(policies[name])
+					fmt.Fprintf(w, "%s\t%v\t%v\t%v\n", name, s["status"], s["restart_count"], s["last_error"])
+				}
+			})
+		},
+	}
+
+	listCmd.Flags().StringVarP(&Selector, "selector", "l", "", "Label selector, e.g. team=payments,env!=dev")
+	listCmd.Flags().StringVar(&StatusQuery, "status", "", "Comma separated statuses to show, e.g. runner_error")
+
+	getCmd := &cobra.Command{
+		Use:   "get POLICY",
+		Short: "Show a policy definition and its status",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			p, err := c.GetPolicy(args[0])
+			if err != nil {
+				return err
+			}
+			return printOutput(p, func(w *tabwriter.Writer) {
+				s := policyState(p[args[0]])
+				fmt.Fprintln(w, "NAME\tSTATUS\tRESTARTS\tLAST RESTART\tLAST ERROR")
+				fmt.Fprintf(w, "%s\t%v\t%v\t%v\t%v\n", args[0], s["status"], s["restart_count"], s["last_restart_time"], s["last_error"])
+			})
+		},
+	}
+
+	applyCmd := &cobra.Command{
+		Use:   "apply -f FILE",
+		Short: "Apply a policy file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := os.ReadFile(PolicyFile)
+			if err != nil {
+				return err
+			}
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			p, err := c.ApplyPolicy(b)
+			if err != nil {
+				return err
+			}
+			return printOutput(p, func(w *tabwriter.Writer) {
+				fmt.Fprintln(w, "NAME\tSTATUS")
+				for name, policy := range p {
+					fmt.Fprintf(w, "%s\t%v\n", name, policyState(policy)["status"])
+				}
+			})
+		},
+	}
+	applyCmd.Flags().StringVarP(&PolicyFile, "file", "f", "", "Policy file in the Policy RFC format")
+	cobra.CheckErr(applyCmd.MarkFlagRequired("file"))
+
+	deleteCmd := &cobra.Command{
+		Use:   "delete POLICY... | -l SELECTOR",
+		Short: "Delete one or more policies",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (len(args) == 0) == (Selector == "" && StatusQuery == "") {
+				return fmt.Errorf("give either policy names or a --selector/--status")
+			}
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				deleted, err := c.DeletePolicies(Selector, StatusQuery)
+				if err != nil {
+					return err
+				}
+				for _, name := range deleted {
+					fmt.Println(name + " was deleted")
+				}
+				return nil
+			}
+			for _, name := range args {
+				msg, err := c.DeletePolicy(name)
+				if err != nil {
+					return err
+				}
+				fmt.Println(msg)
+			}
+			return nil
+		},
+	}
+
+	deleteCmd.Flags().StringVarP(&Selector, "selector", "l", "", "Delete the policies matching this label selector")
+	deleteCmd.Flags().StringVar(&StatusQuery, "status", "", "Delete the policies in these comma separated statuses")
+
+	logsCmd := &cobra.Command{
+		Use:   "logs POLICY",
+		Short: "Show the latest collector logs of a policy",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			logs, err := c.PolicyLogs(args[0], LogsTail)
+			if err != nil {
+				return err
+			}
+			return printOutput(logs, func(w *tabwriter.Writer) {
+				for _, l := range logs {
+					fmt.Fprintln(w, l)
+				}
+			})
+		},
+	}
+	logsCmd.Flags().IntVar(&LogsTail, "tail", 0, "Number of most recent lines to show (0 shows all retained lines)")
+
+	statsCmd := &cobra.Command{
+		Use:   "stats POLICY",
+		Short: "Show the CPU, memory, file descriptors and threads used by the collector of a policy",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			stats, err := c.PolicyStats(args[0])
+			if err != nil {
+				return err
+			}
+			return printOutput(stats, func(w *tabwriter.Writer) {
+				fmt.Fprintln(w, "NAME\tPID\tCPU SECONDS\tRSS BYTES\tOPEN FDS\tTHREADS")
+				fmt.Fprintf(w, "%s\t%v\t%v\t%v\t%v\t%v\n", args[0], stats["pid"], stats["cpu_seconds"], stats["rss_bytes"], stats["open_fds"], stats["threads"])
+			})
+		},
+	}
+
+	probeCmd := &cobra.Command{
+		Use:   "probe POLICY",
+		Short: "Send synthetic telemetry to the OTLP receivers of a policy and show whether it was accepted",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			probe, err := c.ProbePolicy(args[0])
+			if err != nil {
+				return err
+			}
+			if err = printOutput(probe, func(w *tabwriter.Writer) {
+				fmt.Fprintln(w, "RECEIVER\tPROTOCOL\tENDPOINT\tSIGNAL\tACCEPTED\tLATENCY MS\tERROR")
+				results, _ := probe["results"].([]interface{})
+				for _, r := range results {
+					result, _ := r.(map[string]interface{})
+					message, _ := result["error"].(string)
+					fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%s\n", result["receiver"], result["protocol"], result["endpoint"],
+						result["signal"], result["accepted"], result["latency_ms"], message)
+				}
+			}); err != nil {
+				return err
+			}
+			if accepted, _ := probe["accepted"].(bool); !accepted {
+				return fmt.Errorf("policy %s did not accept all the synthetic telemetry", args[0])
+			}
+			return nil
+		},
+	}
+
+	var tapSignal, tapPipeline string
+	var tapRate int
+	tapCmd := &cobra.Command{
+		Use:   "tap POLICY",
+		Short: "Print the telemetry flowing through a pipeline of a policy as OTLP JSON, one request per line",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if tapSignal == "" && tapPipeline == "" {
+				return fmt.Errorf("--signal or --pipeline is required")
+			}
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+			return c.Tap(ctx, args[0], tapSignal, tapPipeline, tapRate, func(event string, data json.RawMessage) error {
+				switch event {
+				case "tap":
+					var start map[string]interface{}
+					if err := json.Unmarshal(data, &start); err != nil {
+						return err
+					}
+					fmt.Fprintf(os.Stderr, "tapping pipeline %v of policy %s, press Ctrl+C to stop\n", start["pipeline"], args[0])
+				case "end":
+					var end map[string]interface{}
+					if err := json.Unmarshal(data, &end); err != nil {
+						return err
+					}
+					return fmt.Errorf("%v", end["message"])
+				default:
+					fmt.Println(string(data))
+				}
+				return nil
+			})
+		},
+	}
+	tapCmd.Flags().StringVar(&tapSignal, "signal", "", "Signal to tap, traces, metrics or logs, selecting the pipeline named after it or else its first pipeline")
+	tapCmd.Flags().StringVar(&tapPipeline, "pipeline", "", "Pipeline to tap")
+	tapCmd.Flags().IntVar(&tapRate, "rate", 0, "Maximum OTLP requests printed every second (defaults to the server default)")
+
+	revisionsCmd := &cobra.Command{
+		Use:   "revisions POLICY",
+		Short: "List the revisions kept for a policy",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			revisions, err := c.Revisions(args[0])
+			if err != nil {
+				return err
+			}
+			return printOutput(revisions, func(w *tabwriter.Writer) {
+				fmt.Fprintln(w, "REVISION\tTIMESTAMP\tAUTHOR\tCOMMENT")
+				for _, r := range revisions {
+					fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", r["revision"], r["timestamp"], r["author"], r["comment"])
+				}
+			})
+		},
+	}
+
+	diffCmd := &cobra.Command{
+		Use:   "diff POLICY REVISION",
+		Short: "Show the changes of a policy since a revision",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid revision %q", args[1])
+			}
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			d, err := c.DiffRevisions(args[0], from, RevisionTo)
+			if err != nil {
+				return err
+			}
+			fmt.Print(d)
+			return nil
+		},
+	}
+	diffCmd.Flags().Int64Var(&RevisionTo, "to", 0, "Revision to compare with (defaults to the latest)")
+
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback POLICY --to REVISION",
+		Short: "Apply again the definition a policy had at a revision",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			p, err := c.Rollback(args[0], RevisionTo)
+			if err != nil {
+				return err
+			}
+			return printOutput(p, func(w *tabwriter.Writer) {
+				fmt.Fprintln(w, "NAME\tSTATUS")
+				fmt.Fprintf(w, "%s\t%v\n", args[0], policyState(p[args[0]])["status"])
+			})
+		},
+	}
+	rollbackCmd.Flags().Int64Var(&RevisionTo, "to", 0, "Revision to roll back to")
+	cobra.CheckErr(rollbackCmd.MarkFlagRequired("to"))
+
+	actions := map[string]struct {
+		short string
+		run   func(c *client.Client, name string) (map[string]interface{}, error)
+	}{
+		"pause":   {"Stop the collector of a policy, keeping its definition", (*client.Client).PausePolicy},
+		"resume":  {"Start again the collector of a paused policy", (*client.Client).ResumePolicy},
+		"restart": {"Restart the collector of a policy", (*client.Client).RestartPolicy},
+	}
+	for _, name := range []string{"pause", "resume", "restart"} {
+		action := actions[name]
+		cmd.AddCommand(&cobra.Command{
+			Use:   name + " POLICY",
+			Short: action.short,
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				c, err := newClient()
+				if err != nil {
+					return err
+				}
+				p, err := action.run(c, args[0])
+				if err != nil {
+					return err
+				}
+				return printOutput(p, func(w *tabwriter.Writer) {
+					s := policyState(p[args[0]])
+					fmt.Fprintln(w, "NAME\tSTATUS\tRESTARTS")
+					fmt.Fprintf(w, "%s\t%v\t%v\n", args[0], s["status"], s["restart_count"])
+				})
+			},
+		})
+	}
+
+	cmd.AddCommand(listCmd, getCmd, applyCmd, deleteCmd, logsCmd, statsCmd, probeCmd, tapCmd, revisionsCmd, diffCmd, rollbackCmd)
+	return cmd
+}
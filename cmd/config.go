@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "<redacted>"
+
+// flagKeys maps the run flags to their configuration keys.
+var flagKeys = map[string]string{
+	"debug":                "debug",
+	"self_telemetry":       "self_telemetry",
+	"collector_binary":     "collector_binary",
+	"server_host":          "server.host",
+	"server_port":          "server.port",
+	"server_socket":        "server.socket",
+	"server_token":         "auth.token",
+	"tls_cert_file":        "server.tls.cert_file",
+	"tls_key_file":         "server.tls.key_file",
+	"tls_client_ca_file":   "server.tls.client_ca_file",
+	"log_level":            "logging.level",
+	"log_format":           "logging.format",
+	"log_file":             "logging.file",
+	"policy_start_timeout": "policy_defaults.startup_timeout",
+	"secrets_dir":          "secrets.dir",
+	"cgroup_dir":           "cgroup.dir",
+}
+
+func addRunFlags(cmd *cobra.Command) {
+	flags := cmd.PersistentFlags()
+	flags.String("config", os.Getenv("OTLPINF_CONFIG"), "Path to a YAML configuration file")
+	flags.BoolP("debug", "d", false, "Enable verbose (debug level) output")
+	flags.BoolP("self_telemetry", "s", false, "Enable self telemetry for collectors. It is disabled by default to avoid port conflict")
+	flags.String("collector_binary", "", "Run policies with this collector executable instead of the embedded otelcol-contrib")
+	flags.StringP("server_host", "a", "localhost", "Define REST Host")
+	flags.Uint64P("server_port", "p", 10222, "Define REST Port")
+	flags.String("server_socket", "", "Define a unix socket to also serve REST on")
+	flags.String("server_token", "", "Require this bearer token on every REST request")
+	flags.String("tls_cert_file", "", "Serve REST over TLS using this certificate")
+	flags.String("tls_key_file", "", "Private key of the TLS certificate")
+	flags.String("tls_client_ca_file", "", "Require client certificates signed by this CA")
+	flags.String("log_level", "info", "Define log level (debug, info, warn, error)")
+	flags.String("log_format", "json", "Define log format (json, console)")
+	flags.String("log_file", "", "Write logs to this file, rotating it, instead of stdout")
+	flags.String("secrets_dir", "", "Directory holding one file per secret referenced as ${secret:name} in policies")
+	flags.String("cgroup_dir", "", "Delegated cgroup v2 directory to enforce policy memory and cpu limits in")
+	flags.Duration("policy_start_timeout", defaultConfig.PolicyDefaults.StartupTimeout, "Time a collector must stay up to be considered running")
+}
+
+var defaultConfig = config.Config{
+	Server: config.ServerConfig{
+		Host: "localhost",
+		Port: 10222,
+	},
+	Logging: config.LoggingConfig{
+		Level:      "info",
+		Format:     "json",
+		MaxSizeMB:  100,
+		MaxBackups: 5,
+		MaxAgeDays: 30,
+	},
+	Limits: config.LimitsConfig{
+		MaxRequestBodyBytes:   10 << 20,
+		MaxCollectorBodyBytes: 1 << 30,
+		MaxPolicyRevisions:    10,
+	},
+	Secrets: config.SecretsConfig{
+		EnvPrefix: "OTLPINF_SECRET_",
+	},
+	PolicyDefaults: config.PolicyDefaults{
+		StartupTimeout: 1 * time.Second,
+	},
+}
+
+func setDefaults(v *viper.Viper) {
+	// note: viper seems to require a default (or a BindEnv) to be overridden by environment variables
+	d := defaultConfig
+	v.SetDefault("debug", d.Debug)
+	v.SetDefault("self_telemetry", d.SelfTelemetry)
+	v.SetDefault("collector_binary", d.CollectorBinary)
+	v.SetDefault("server.host", d.Server.Host)
+	v.SetDefault("server.port", d.Server.Port)
+	v.SetDefault("server.socket", d.Server.Socket)
+	v.SetDefault("server.tls.cert_file", d.Server.TLS.CertFile)
+	v.SetDefault("server.tls.key_file", d.Server.TLS.KeyFile)
+	v.SetDefault("server.tls.client_ca_file", d.Server.TLS.ClientCAFile)
+	v.SetDefault("auth.token", d.Auth.Token)
+	v.SetDefault("logging.level", d.Logging.Level)
+	v.SetDefault("logging.format", d.Logging.Format)
+	v.SetDefault("logging.file", d.Logging.File)
+	v.SetDefault("logging.max_size_mb", d.Logging.MaxSizeMB)
+	v.SetDefault("logging.max_backups", d.Logging.MaxBackups)
+	v.SetDefault("logging.max_age_days", d.Logging.MaxAgeDays)
+	v.SetDefault("logging.compress", d.Logging.Compress)
+	v.SetDefault("limits.max_request_body_bytes", d.Limits.MaxRequestBodyBytes)
+	v.SetDefault("limits.max_collector_body_bytes", d.Limits.MaxCollectorBodyBytes)
+	v.SetDefault("limits.max_policy_revisions", d.Limits.MaxPolicyRevisions)
+	v.SetDefault("collector_upload.dir", d.CollectorUpload.Dir)
+	v.SetDefault("collector_upload.public_key_file", d.CollectorUpload.PublicKeyFile)
+	v.SetDefault("quotas.max_policies", d.Quotas.MaxPolicies)
+	v.SetDefault("quotas.max_memory_limiter_mib", d.Quotas.MaxMemoryLimiterMiB)
+	v.SetDefault("quotas.max_listening_ports", d.Quotas.MaxListeningPorts)
+	v.SetDefault("secrets.dir", d.Secrets.Dir)
+	v.SetDefault("secrets.env_prefix", d.Secrets.EnvPrefix)
+	v.SetDefault("policy_defaults.startup_timeout", d.PolicyDefaults.StartupTimeout)
+	v.SetDefault("policy_defaults.feature_gates", d.PolicyDefaults.FeatureGates)
+	v.SetDefault("policy_defaults.set", d.PolicyDefaults.Set)
+	v.SetDefault("policy_defaults.limits.memory_mb", d.PolicyDefaults.Limits.MemoryMB)
+	v.SetDefault("policy_defaults.limits.cpu", d.PolicyDefaults.Limits.CPU)
+	v.SetDefault("policy_defaults.limits.open_files", d.PolicyDefaults.Limits.OpenFiles)
+	// nice has no default value, it is only set so that OTLPINF_POLICY_DEFAULTS_LIMITS_NICE is read
+	v.SetDefault("policy_defaults.limits.nice", d.PolicyDefaults.Limits.Nice)
+	v.SetDefault("cgroup.dir", d.Cgroup.Dir)
+}
+
+// loadConfig merges the command flags, OTLPINF_* environment variables, the configuration
+// file and the defaults, in this order of precedence.
+func loadConfig(cmd *cobra.Command) (*config.Config, error) {
+	v := viper.New()
+	v.SetEnvPrefix("otlpinf")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	setDefaults(v)
+	for flag, key := range flagKeys {
+		if err := v.BindPFlag(key, cmd.Flags().Lookup(flag)); err != nil {
+			return nil, err
+		}
+	}
+	if file, _ := cmd.Flags().GetString("config"); file != "" {
+		v.SetConfigFile(file)
+		v.SetConfigType("yaml")
+		if err := v.ReadInConfig(); err != nil {
+			return nil, err
+		}
+	}
+	var c config.Config
+	if err := v.Unmarshal(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect opentelemetry-infinity configuration",
+	}
+	printCmd := &cobra.Command{
+		Use:   "print",
+		Short: "Print the effective configuration merged from flags, environment, config file and defaults",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := loadConfig(cmd)
+			if err != nil {
+				return err
+			}
+			if c.Auth.Token != "" {
+				c.Auth.Token = redacted
+			}
+			for i := range c.Webhooks {
+				if c.Webhooks[i].Secret != "" {
+					c.Webhooks[i].Secret = redacted
+				}
+				for k := range c.Webhooks[i].Headers {
+					c.Webhooks[i].Headers[k] = redacted
+				}
+			}
+			b, err := yaml.Marshal(c)
+			if err != nil {
+				return err
+			}
+			fmt.Print(string(b))
+			return nil
+		},
+	}
+	addRunFlags(printCmd)
+	cmd.AddCommand(printCmd)
+	return cmd
+}
@@ -5,59 +5,45 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 
 	"github.com/leoparente/opentelemetry-infinity/config"
 	"github.com/leoparente/opentelemetry-infinity/otlpinf"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 var (
-	Debug         bool
 	SelfTelemetry bool
 	ServerHost    string
 	ServerPort    uint64
+	ServerSocket  string
+	ServerToken   string
 )
 
 func Run(cmd *cobra.Command, args []string) {
 
-	initConfig()
-
 	// configuration
-	var config config.Config
-
-	err := viper.Unmarshal(&config)
+	config, err := loadConfig(cmd)
 	if err != nil {
 		cobra.CheckErr(fmt.Errorf("opentelemetry-infinity start up error (config): %w", err))
 		os.Exit(1)
 	}
 
 	// logger
-	var logger *zap.Logger
-	atomicLevel := zap.NewAtomicLevel()
-	if Debug {
-		atomicLevel.SetLevel(zap.DebugLevel)
-	} else {
-		atomicLevel.SetLevel(zap.InfoLevel)
+	logger, atomicLevel, err := newLogger(config)
+	if err != nil {
+		cobra.CheckErr(fmt.Errorf("opentelemetry-infinity start up error (logger): %w", err))
+		os.Exit(1)
 	}
-	encoderCfg := zap.NewProductionEncoderConfig()
-	encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
-	core := zapcore.NewCore(
-		zapcore.NewJSONEncoder(encoderCfg),
-		os.Stdout,
-		atomicLevel,
-	)
-	logger = zap.New(core, zap.AddCaller())
 	defer func(logger *zap.Logger) {
 		_ = logger.Sync()
 	}(logger)
 
 	// new otlpinf
-	a, err := otlpinf.New(logger, &config)
+	a, err := otlpinf.New(logger, config, otlpinf.WithLogLevel(atomicLevel))
 	if err != nil {
 		logger.Error("otlpinf start up error", zap.Error(err))
 		os.Exit(1)
@@ -94,23 +80,45 @@ func Run(cmd *cobra.Command, args []string) {
 	<-done
 }
 
-func initConfig() {
-	v := viper.New()
-	v.AutomaticEnv()
-	replacer := strings.NewReplacer(".", "_")
-	v.SetEnvKeyReplacer(replacer)
-	// note: viper seems to require a default (or a BindEnv) to be overridden by environment variables
-	v.SetDefault("otlpinf_debug", Debug)
-	v.SetDefault("otlpinf_self_telemetry", SelfTelemetry)
-	v.SetDefault("otlpinf_server_host", ServerHost)
-	v.SetDefault("otlpinf_server_port", ServerPort)
-	cobra.CheckErr(viper.MergeConfigMap(v.AllSettings()))
+func newLogger(c *config.Config) (*zap.Logger, zap.AtomicLevel, error) {
+	atomicLevel := zap.NewAtomicLevel()
+	if c.Debug {
+		atomicLevel.SetLevel(zap.DebugLevel)
+	} else if level, err := zapcore.ParseLevel(c.Logging.Level); err == nil {
+		atomicLevel.SetLevel(level)
+	} else {
+		return nil, atomicLevel, err
+	}
+	encoderCfg := zap.NewProductionEncoderConfig()
+	encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+	var encoder zapcore.Encoder
+	switch c.Logging.Format {
+	case "", "json":
+		encoder = zapcore.NewJSONEncoder(encoderCfg)
+	case "console":
+		encoder = zapcore.NewConsoleEncoder(encoderCfg)
+	default:
+		return nil, atomicLevel, fmt.Errorf("invalid log format %q, use json or console", c.Logging.Format)
+	}
+	var output zapcore.WriteSyncer = os.Stdout
+	if c.Logging.File != "" {
+		output = zapcore.AddSync(&lumberjack.Logger{
+			Filename:   c.Logging.File,
+			MaxSize:    c.Logging.MaxSizeMB,
+			MaxBackups: c.Logging.MaxBackups,
+			MaxAge:     c.Logging.MaxAgeDays,
+			Compress:   c.Logging.Compress,
+		})
+	}
+	core := zapcore.NewCore(encoder, output, atomicLevel)
+	return zap.New(core, zap.AddCaller()), atomicLevel, nil
 }
 
 func main() {
 
 	rootCmd := &cobra.Command{
-		Use: "opentelemetry-infinity",
+		Use:          "opentelemetry-infinity",
+		SilenceUsage: true,
 	}
 
 	runCmd := &cobra.Command{
@@ -119,12 +127,10 @@ func main() {
 		Long:  `Run opentelemetry-infinity`,
 		Run:   Run,
 	}
+	addRunFlags(runCmd)
 
-	runCmd.PersistentFlags().BoolVarP(&Debug, "debug", "d", false, "Enable verbose (debug level) output")
-	runCmd.PersistentFlags().BoolVarP(&SelfTelemetry, "self_telemetry", "s", false, "Enable self telemetry for collectors. It is disabled by default to avoid port conflict")
-	runCmd.PersistentFlags().StringVarP(&ServerHost, "server_host", "a", "localhost", "Define REST Host")
-	runCmd.PersistentFlags().Uint64VarP(&ServerPort, "server_port", "p", 10222, "Define REST Port")
-
-	rootCmd.AddCommand(runCmd)
-	rootCmd.Execute()
+	rootCmd.AddCommand(runCmd, newConfigCmd(), newStatusCmd(), newCapabilitiesCmd(), newCollectorsCmd(), newEventsCmd(), newPoliciesCmd(), newValidateCmd(), newRenderCmd())
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }
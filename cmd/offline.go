@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+	"github.com/leoparente/opentelemetry-infinity/secrets"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	SecretsDir      string
+	CollectorBinary string
+)
+
+// policyBinary returns the collector binary a policy runs, empty for the embedded otelcol-contrib.
+func policyBinary(policy *config.Policy) string {
+	if policy.Binary != "" {
+		return policy.Binary
+	}
+	return CollectorBinary
+}
+
+// readPolicies strictly decodes a policy file, rejecting fields that are not part of config.Policy.
+func readPolicies(file string) (map[string]config.Policy, []string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	var policies map[string]config.Policy
+	if err = dec.Decode(&policies); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(policies) == 0 {
+		return nil, nil, fmt.Errorf("%s: no policy found", file)
+	}
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return policies, names, nil
+}
+
+func validatePolicy(name string, policy *config.Policy, components runner.Components, policyDir string) []string {
+	if len(policy.Include) > 0 {
+		// fragments only exist in a running otlpinf, so the policy cannot be rendered offline
+		return []string{"include field is not supported offline, validate the policy with getPolicy?rendered=true instead"}
+	}
+	if len(policy.Config) == 0 && len(policy.Sources) == 0 {
+		return []string{"config field is required"}
+	}
+	problems := make([]string, 0)
+	collector := "otelcol-contrib"
+	if binary := policyBinary(policy); binary != "" {
+		collector = binary
+	}
+	for _, m := range components.Missing(policy) {
+		problems = append(problems, "component not available in "+collector+": "+m)
+	}
+	store := secrets.New(SecretsDir, defaultConfig.Secrets.EnvPrefix)
+	err := runner.Validate(name, policyDir, policy, SelfTelemetry, runner.WithSecrets(store),
+		runner.WithBinary(CollectorBinary))
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+func shellQuote(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t\n\"'\\$`*?") {
+			quoted[i] = strconv.Quote(a)
+		} else {
+			quoted[i] = a
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+func newValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate -f FILE",
+		Short: "Validate a policy file without a running opentelemetry-infinity",
+		Long:  `Validate a policy file against the policy schema, the components available in the embedded otelcol-contrib and the collector's own validation`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			policies, names, err := readPolicies(PolicyFile)
+			if err != nil {
+				return err
+			}
+			components := make(map[string]runner.Components)
+			for _, name := range names {
+				policy := policies[name]
+				binary := policyBinary(&policy)
+				if _, ok := components[binary]; ok {
+					continue
+				}
+				if binary != "" {
+					if err = runner.CheckBinary(binary); err != nil {
+						return fmt.Errorf("%s: %w", name, err)
+					}
+				}
+				caps, err := runner.GetCapabilities(binary)
+				if err != nil {
+					return err
+				}
+				if components[binary], err = runner.ParseComponents(caps); err != nil {
+					return err
+				}
+			}
+			policyDir, err := os.MkdirTemp("", "policies")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(policyDir)
+
+			invalid := 0
+			for _, name := range names {
+				policy := policies[name]
+				problems := validatePolicy(name, &policy, components[policyBinary(&policy)], policyDir)
+				if len(problems) == 0 {
+					fmt.Printf("%s: valid\n", name)
+					continue
+				}
+				invalid++
+				fmt.Printf("%s: invalid\n", name)
+				for _, p := range problems {
+					fmt.Printf("  - %s\n", strings.ReplaceAll(p, "\n", "\n    "))
+				}
+			}
+			if invalid > 0 {
+				return errors.New(strconv.Itoa(invalid) + " of " + strconv.Itoa(len(names)) + " policies are invalid")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&PolicyFile, "file", "f", "", "Policy file in the Policy RFC format")
+	cmd.Flags().BoolVarP(&SelfTelemetry, "self_telemetry", "s", false, "Validate as if self telemetry was enabled for collectors")
+	cmd.Flags().StringVar(&SecretsDir, "secrets_dir", "", "Directory holding one file per secret referenced as ${secret:name} in policies")
+	cmd.Flags().StringVar(&CollectorBinary, "collector_binary", "", "Validate against this collector executable instead of the embedded otelcol-contrib")
+	cobra.CheckErr(cmd.MarkFlagRequired("file"))
+	return cmd
+}
+
+func newRenderCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "render -f FILE",
+		Short: "Print the collector config file and command line produced for each policy",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			policies, names, err := readPolicies(PolicyFile)
+			if err != nil {
+				return err
+			}
+			for i, name := range names {
+				policy := policies[name]
+				policyFile := filepath.Join("<policies_dir>", name)
+				files, options, err := runner.RenderFiles(&policy, policyFile, SelfTelemetry)
+				if err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+				if i > 0 {
+					fmt.Println("---")
+				}
+				fmt.Printf("# policy: %s\n", name)
+				collector := "otelcol-contrib"
+				if binary := policyBinary(&policy); binary != "" {
+					collector = binary
+				}
+				fmt.Printf("# command: %s\n", shellQuote(append([]string{collector}, options...)))
+				for _, f := range files {
+					fmt.Printf("# %s:\n", f.Path)
+					fmt.Print(string(f.Content))
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&PolicyFile, "file", "f", "", "Policy file in the Policy RFC format")
+	cmd.Flags().BoolVarP(&SelfTelemetry, "self_telemetry", "s", false, "Render as if self telemetry was enabled for collectors")
+	cmd.Flags().StringVar(&CollectorBinary, "collector_binary", "", "Render for this collector executable instead of the embedded otelcol-contrib")
+	cobra.CheckErr(cmd.MarkFlagRequired("file"))
+	return cmd
+}
@@ -1,22 +1,235 @@
 package config
 
-import "time"
+import (
+	"errors"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
 
 type Status struct {
 	StartTime time.Time     `json:"start_time"`
 	UpTime    time.Duration `json:"up_time"`
 	Version   string        `json:"version"`
+	Quotas    QuotaStatus   `json:"quotas"`
+}
+
+// QuotaStatus reports the usage of every global quota.
+type QuotaStatus struct {
+	Policies         QuotaUsage `json:"policies"`
+	MemoryLimiterMiB QuotaUsage `json:"memory_limiter_mib"`
+	ListeningPorts   QuotaUsage `json:"listening_ports"`
+}
+
+// QuotaUsage is the amount used of a quota, which is unlimited when Limit is zero.
+type QuotaUsage struct {
+	Used  int64 `json:"used"`
+	Limit int64 `json:"limit"`
 }
 
 type Policy struct {
+	Description  string                 `yaml:"description,omitempty"`
+	Owner        string                 `yaml:"owner,omitempty"`
+	Labels       map[string]string      `yaml:"labels,omitempty"`
+	Annotations  map[string]string      `yaml:"annotations,omitempty"`
 	FeatureGates []string               `yaml:"feature_gates"`
 	Set          map[string]string      `yaml:"set"`
 	Config       map[string]interface{} `yaml:"config"`
+	Include      []string               `yaml:"include,omitempty"`
+	Sources      []ConfigSource         `yaml:"sources,omitempty"`
+	LogLevel     string                 `yaml:"log_level,omitempty"`
+	Binary       string                 `yaml:"binary,omitempty"`
+	Collector    string                 `yaml:"collector,omitempty"`
+	Limits       *ResourceLimits        `yaml:"limits,omitempty"`
+	Template     *TemplateRef           `yaml:"template,omitempty"`
+}
+
+// ConfigSource is a collector config merged over the policy config by the collector itself,
+// either an inline config or a URI such as file:, env:, yaml: or a local http: address.
+type ConfigSource struct {
+	URI    string
+	Config map[string]interface{}
+}
+
+// UnmarshalYAML decodes a string as a URI and a map as an inline config.
+func (s *ConfigSource) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		return value.Decode(&s.URI)
+	case yaml.MappingNode:
+		return value.Decode(&s.Config)
+	default:
+		return errors.New("config source must be a URI or a config map")
+	}
+}
+
+func (s ConfigSource) MarshalYAML() (interface{}, error) {
+	if s.Config != nil {
+		return s.Config, nil
+	}
+	return s.URI, nil
+}
+
+// ResourceLimits bounds the resources of a collector process. Zero values leave a resource
+// unlimited. MemoryMB and CPU, in cores, are enforced by a cgroup v2 and require one to be
+// configured.
+type ResourceLimits struct {
+	MemoryMB  int64   `mapstructure:"memory_mb" yaml:"memory_mb,omitempty"`
+	CPU       float64 `mapstructure:"cpu" yaml:"cpu,omitempty"`
+	OpenFiles uint64  `mapstructure:"open_files" yaml:"open_files,omitempty"`
+	Nice      *int    `mapstructure:"nice" yaml:"nice,omitempty"`
+}
+
+// TemplateRef records the template a policy was instantiated from.
+type TemplateRef struct {
+	Name    string `yaml:"name"`
+	Version int64  `yaml:"version"`
+}
+
+type TemplateParameter struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Required    bool   `yaml:"required,omitempty"`
+	Default     string `yaml:"default,omitempty"`
+}
+
+// Template is a policy whose strings may contain `${parameter}` or Go template `{{ .parameter }}`
+// placeholders. Version is managed by otlpinf and increased on every update.
+type Template struct {
+	Version    int64               `yaml:"version"`
+	Parameters []TemplateParameter `yaml:"parameters"`
+	Policy     Policy              `yaml:"policy"`
+}
+
+// Fragment is a named part of a collector config that policies merge into theirs by listing it
+// in their include field. Fragments cannot be changed, only deleted when no policy includes them.
+type Fragment struct {
+	Description string                 `yaml:"description,omitempty"`
+	Config      map[string]interface{} `yaml:"config"`
+}
+
+// TemplateInstance is the request to create a policy from a template.
+type TemplateInstance struct {
+	Name       string            `yaml:"name"`
+	Parameters map[string]string `yaml:"parameters"`
+}
+
+type TLSConfig struct {
+	CertFile     string `mapstructure:"cert_file" yaml:"cert_file"`
+	KeyFile      string `mapstructure:"key_file" yaml:"key_file"`
+	ClientCAFile string `mapstructure:"client_ca_file" yaml:"client_ca_file"`
+}
+
+type ServerConfig struct {
+	Host   string    `mapstructure:"host" yaml:"host"`
+	Port   uint64    `mapstructure:"port" yaml:"port"`
+	Socket string    `mapstructure:"socket" yaml:"socket"`
+	TLS    TLSConfig `mapstructure:"tls" yaml:"tls"`
+}
+
+type AuthConfig struct {
+	Token string `mapstructure:"token" yaml:"token"`
+}
+
+// LoggingConfig defines otlpinf own logs. When File is set logs are written to it instead of
+// stdout and rotated once they reach MaxSizeMB.
+type LoggingConfig struct {
+	Level      string `mapstructure:"level" yaml:"level"`
+	Format     string `mapstructure:"format" yaml:"format"`
+	File       string `mapstructure:"file" yaml:"file"`
+	MaxSizeMB  int    `mapstructure:"max_size_mb" yaml:"max_size_mb"`
+	MaxBackups int    `mapstructure:"max_backups" yaml:"max_backups"`
+	MaxAgeDays int    `mapstructure:"max_age_days" yaml:"max_age_days"`
+	Compress   bool   `mapstructure:"compress" yaml:"compress"`
+}
+
+type LimitsConfig struct {
+	MaxRequestBodyBytes   int64 `mapstructure:"max_request_body_bytes" yaml:"max_request_body_bytes"`
+	MaxCollectorBodyBytes int64 `mapstructure:"max_collector_body_bytes" yaml:"max_collector_body_bytes"`
+	MaxPolicyRevisions    int   `mapstructure:"max_policy_revisions" yaml:"max_policy_revisions"`
+}
+
+// QuotasConfig bounds the policies of otlpinf as a whole, a zero value leaving a quota unlimited.
+// MaxMemoryLimiterMiB bounds the sum of the memory_limiter processors limit_mib of all policies,
+// and MaxListeningPorts the ports their receivers and extensions listen on.
+type QuotasConfig struct {
+	MaxPolicies         int64 `mapstructure:"max_policies" yaml:"max_policies"`
+	MaxMemoryLimiterMiB int64 `mapstructure:"max_memory_limiter_mib" yaml:"max_memory_limiter_mib"`
+	MaxListeningPorts   int64 `mapstructure:"max_listening_ports" yaml:"max_listening_ports"`
+}
+
+// SecretsConfig defines where `${secret:name}` references are resolved from: a file called
+// name inside Dir, or else the EnvPrefix + NAME environment variable.
+type SecretsConfig struct {
+	Dir       string `mapstructure:"dir" yaml:"dir"`
+	EnvPrefix string `mapstructure:"env_prefix" yaml:"env_prefix"`
+}
+
+// PolicyDefaults are applied to every policy when its runner is configured. Feature gates are
+// added to the policy ones and sets are overridden by the policy sets with the same key.
+type PolicyDefaults struct {
+	StartupTimeout time.Duration     `mapstructure:"startup_timeout" yaml:"startup_timeout"`
+	FeatureGates   []string          `mapstructure:"feature_gates" yaml:"feature_gates"`
+	Set            map[string]string `mapstructure:"set" yaml:"set"`
+	Limits         ResourceLimits    `mapstructure:"limits" yaml:"limits"`
+}
+
+// CollectorConfig names a collector binary policies can select with their collector field.
+type CollectorConfig struct {
+	Name   string `mapstructure:"name" yaml:"name"`
+	Binary string `mapstructure:"binary" yaml:"binary"`
+}
+
+// CollectorUploadConfig defines where uploaded collector binaries are stored, a temporary
+// directory removed on exit when Dir is empty. When PublicKeyFile is set, uploads must be signed
+// with its private key.
+type CollectorUploadConfig struct {
+	Dir           string `mapstructure:"dir" yaml:"dir"`
+	PublicKeyFile string `mapstructure:"public_key_file" yaml:"public_key_file"`
+}
+
+// CgroupConfig defines a cgroup v2 directory delegated to otlpinf, where a child cgroup is
+// created for every policy with resource limits. Cgroups are not used when Dir is empty.
+type CgroupConfig struct {
+	Dir string `mapstructure:"dir" yaml:"dir"`
+}
+
+// WebhookConfig defines an endpoint notified of the given triggers: failure, crash_loop,
+// recovery and deleted. When Secret is set the payload is signed with HMAC-SHA256 in the
+// X-Otlpinf-Signature header. Secret and header values may be `${secret:name}` references.
+// Failed deliveries are retried MaxRetries times (3 when zero, none when negative), waiting
+// Backoff before the first retry and doubling it after every attempt.
+type WebhookConfig struct {
+	URL        string            `mapstructure:"url" yaml:"url"`
+	Headers    map[string]string `mapstructure:"headers" yaml:"headers"`
+	Secret     string            `mapstructure:"secret" yaml:"secret"`
+	Triggers   []string          `mapstructure:"triggers" yaml:"triggers"`
+	Policies   []string          `mapstructure:"policies" yaml:"policies"`
+	Timeout    time.Duration     `mapstructure:"timeout" yaml:"timeout"`
+	MaxRetries int               `mapstructure:"max_retries" yaml:"max_retries"`
+	Backoff    time.Duration     `mapstructure:"backoff" yaml:"backoff"`
+}
+
+// CrashLoopConfig defines when a policy is in a crash loop: after Failures failures within Window.
+type CrashLoopConfig struct {
+	Failures int           `mapstructure:"failures" yaml:"failures"`
+	Window   time.Duration `mapstructure:"window" yaml:"window"`
 }
 
 type Config struct {
-	Debug         bool   `mapstructure:"otlpinf_debug"`
-	SelfTelemetry bool   `mapstructure:"otlpinf_self_telemetry"`
-	ServerHost    string `mapstructure:"otlpinf_server_host"`
-	ServerPort    uint64 `mapstructure:"otlpinf_server_port"`
+	Debug           bool                  `mapstructure:"debug" yaml:"debug"`
+	SelfTelemetry   bool                  `mapstructure:"self_telemetry" yaml:"self_telemetry"`
+	CollectorBinary string                `mapstructure:"collector_binary" yaml:"collector_binary"`
+	Collectors      []CollectorConfig     `mapstructure:"collectors" yaml:"collectors"`
+	CollectorUpload CollectorUploadConfig `mapstructure:"collector_upload" yaml:"collector_upload"`
+	Server          ServerConfig          `mapstructure:"server" yaml:"server"`
+	Auth            AuthConfig            `mapstructure:"auth" yaml:"auth"`
+	Logging         LoggingConfig         `mapstructure:"logging" yaml:"logging"`
+	Limits          LimitsConfig          `mapstructure:"limits" yaml:"limits"`
+	Quotas          QuotasConfig          `mapstructure:"quotas" yaml:"quotas"`
+	Secrets         SecretsConfig         `mapstructure:"secrets" yaml:"secrets"`
+	PolicyDefaults  PolicyDefaults        `mapstructure:"policy_defaults" yaml:"policy_defaults"`
+	Webhooks        []WebhookConfig       `mapstructure:"webhooks" yaml:"webhooks"`
+	CrashLoop       CrashLoopConfig       `mapstructure:"crash_loop" yaml:"crash_loop"`
+	Cgroup          CgroupConfig          `mapstructure:"cgroup" yaml:"cgroup"`
 }
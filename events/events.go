@@ -0,0 +1,94 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	Created = "created"
+	Updated = "updated"
+	Deleted = "deleted"
+	Status  = "status"
+)
+
+// subscriptionBuffer is the number of events kept for a subscriber that is not reading. Events
+// beyond it are dropped for that subscriber only.
+const subscriptionBuffer = 64
+
+// Event is a change in the lifecycle or in the runner status of a policy.
+type Event struct {
+	Type            string    `json:"type"`
+	Policy          string    `json:"policy"`
+	OldStatus       string    `json:"old_status,omitempty"`
+	NewStatus       string    `json:"new_status,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	RestartCount    int64     `json:"restart_count"`
+	LastRestartTime time.Time `json:"last_restart_time"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// Bus delivers published events to every subscriber interested in their policy.
+type Bus struct {
+	mutex       sync.RWMutex
+	subscribers map[*Subscription]struct{}
+}
+
+type Subscription struct {
+	bus      *Bus
+	policies map[string]bool
+	events   chan Event
+	once     sync.Once
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[*Subscription]struct{})}
+}
+
+// Publish sends e to the subscribers without blocking. A nil bus discards it.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for s := range b.subscribers {
+		if len(s.policies) > 0 && !s.policies[e.Policy] {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events of the given policies, or of every policy
+// when none is given.
+func (b *Bus) Subscribe(policies ...string) *Subscription {
+	s := &Subscription{bus: b, policies: make(map[string]bool, len(policies)), events: make(chan Event, subscriptionBuffer)}
+	for _, p := range policies {
+		s.policies[p] = true
+	}
+	b.mutex.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mutex.Unlock()
+	return s
+}
+
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close removes the subscription from the bus and closes its events channel.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mutex.Lock()
+		delete(s.bus.subscribers, s)
+		s.bus.mutex.Unlock()
+		close(s.events)
+	})
+}
@@ -0,0 +1,43 @@
+package events
+
+import "testing"
+
+func TestBusPublish(t *testing.T) {
+	// Arrange
+	bus := NewBus()
+	all := bus.Subscribe()
+	filtered := bus.Subscribe("a")
+
+	// Act
+	bus.Publish(Event{Type: Created, Policy: "a"})
+	bus.Publish(Event{Type: Created, Policy: "b"})
+
+	// Assert
+	if len(all.Events()) != 2 {
+		t.Errorf("Expected 2 events, got %v", len(all.Events()))
+	}
+	if len(filtered.Events()) != 1 {
+		t.Errorf("Expected 1 event, got %v", len(filtered.Events()))
+	}
+	if e := <-filtered.Events(); e.Policy != "a" || e.Timestamp.IsZero() {
+		t.Errorf("Expected a timestamped event of policy a, got %+v", e)
+	}
+
+	// Act fill a subscription and close it
+	for i := 0; i < 2*subscriptionBuffer; i++ {
+		bus.Publish(Event{Type: Status, Policy: "a"})
+	}
+	filtered.Close()
+	filtered.Close()
+
+	// Assert
+	if len(all.Events()) != subscriptionBuffer {
+		t.Errorf("Expected events beyond the buffer to be dropped, got %v", len(all.Events()))
+	}
+	if _, ok := <-filtered.Events(); !ok {
+		t.Errorf("Expected buffered events to be kept after close")
+	}
+	if len(bus.subscribers) != 1 {
+		t.Errorf("Expected closed subscription to be removed, got %v subscribers", len(bus.subscribers))
+	}
+}
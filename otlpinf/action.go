@@ -0,0 +1,62 @@
+package otlpinf
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+)
+
+// policyAction runs an action on the runner of a policy and replies with the resulting policy.
+// The action replies by itself when it fails.
+func (o *OltpInf) policyAction(c *gin.Context, action func(policy string, r Runner) bool) {
+	policy := c.Param("policy")
+	o.writeMutex.Lock()
+	defer o.writeMutex.Unlock()
+	rInfo, ok := o.getRunnerInfo(policy)
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return
+	}
+	if !checkPreconditions(c, rInfo, ok) {
+		return
+	}
+	if action(policy, rInfo.Instance) {
+		o.replyPolicy(c, http.StatusOK, policy, rInfo)
+	}
+}
+
+func (o *OltpInf) pausePolicy(c *gin.Context) {
+	o.policyAction(c, func(policy string, r Runner) bool {
+		if r.GetStatus().Status == runner.Paused {
+			c.IndentedJSON(http.StatusConflict, ReturnValue{"policy is already paused"})
+			return false
+		}
+		r.Pause(o.ctx)
+		return true
+	})
+}
+
+func (o *OltpInf) resumePolicy(c *gin.Context) {
+	o.policyAction(c, func(policy string, r Runner) bool {
+		if r.GetStatus().Status != runner.Paused {
+			c.IndentedJSON(http.StatusConflict, ReturnValue{"policy is not paused"})
+			return false
+		}
+		if err := o.runRunner(policy, r); err != nil {
+			replyRunnerError(c, err)
+			return false
+		}
+		return true
+	})
+}
+
+func (o *OltpInf) restartPolicy(c *gin.Context) {
+	o.policyAction(c, func(policy string, r Runner) bool {
+		if err := r.Restart(o.runnerContext(policy)); err != nil {
+			replyRunnerError(c, o.redactError(err))
+			return false
+		}
+		return true
+	})
+}
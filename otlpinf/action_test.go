@@ -0,0 +1,107 @@
+package otlpinf
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestOtlpInfPolicyActions(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55692,
+		},
+	}
+
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		otlp.router.ServeHTTP(w, req)
+		return w
+	}
+	policyAPI := POLICIES_API + "/policy_test"
+	if w := send("POST", POLICIES_API, strings.Replace(TEST_REVISION_POLICY, "%s", "basic", 1)); w.Code != http.StatusCreated {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+	status := func() runner.State {
+		return otlp.policies["policy_test"].Instance.GetStatus()
+	}
+
+	// Act pause policy
+	w := send("POST", policyAPI+"/pause", "")
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	if status().Status != runner.Paused {
+		t.Errorf("Expected policy to be paused, got %v", status().StatusText)
+	}
+
+	// Act pause paused policy
+	w = send("POST", policyAPI+"/pause", "")
+
+	// Assert
+	if w.Code != http.StatusConflict {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusConflict)
+	}
+
+	// Act resume policy
+	w = send("POST", policyAPI+"/resume", "")
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	if status().Status != runner.Running {
+		t.Errorf("Expected policy to be running, got %v", status().StatusText)
+	}
+
+	// Act resume running policy
+	w = send("POST", policyAPI+"/resume", "")
+
+	// Assert
+	if w.Code != http.StatusConflict {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusConflict)
+	}
+
+	// Act restart policy
+	w = send("POST", policyAPI+"/restart", "")
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	if s := status(); s.Status != runner.Running || s.RestartCount != 1 || s.LastRestartTS.IsZero() {
+		t.Errorf("Expected policy to be running after one restart, got %+v", s)
+	}
+
+	// Act restart unknown policy
+	w = send("POST", POLICIES_API+"/unknown/restart", "")
+
+	// Assert
+	if w.Code != http.StatusNotFound {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusNotFound)
+	}
+}
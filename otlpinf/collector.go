@@ -0,0 +1,116 @@
+package otlpinf
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+)
+
+// defaultCollector is the name of the collector policies run when they select none: the
+// collector_binary, or the embedded otelcol-contrib.
+const defaultCollector = "default"
+
+var collectorName = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?$`)
+
+// Collector is a collector distribution policies select by name with their collector field.
+type Collector struct {
+	Name       string              `json:"name"`
+	Binary     string              `json:"binary,omitempty"`
+	Version    string              `json:"version"`
+	SHA256     string              `json:"sha256,omitempty"`
+	Default    bool                `json:"default"`
+	Components map[string][]string `json:"components"`
+}
+
+// registerCollector adds the collector binary to the collectors as name, reading its version and
+// components from its components command.
+func (o *OltpInf) registerCollector(name string, binary string) (Collector, error) {
+	capabilities, err := o.binaryCapabilities(binary)
+	if err != nil {
+		return Collector{}, fmt.Errorf("failed to get collector %s components: %w", name, err)
+	}
+	components, err := runner.ParseComponents(capabilities)
+	if err != nil {
+		return Collector{}, fmt.Errorf("failed to parse collector %s components: %w", name, err)
+	}
+	collector := Collector{Name: name, Binary: binary, Version: components.Buildinfo.Version,
+		Default: name == defaultCollector, Components: components.Names()}
+	o.collectorsMutex.Lock()
+	defer o.collectorsMutex.Unlock()
+	o.collectors[name] = collector
+	return collector, nil
+}
+
+// startCollectors registers the default collector and the configured ones.
+func (o *OltpInf) startCollectors() error {
+	if o.conf.CollectorBinary != "" {
+		if err := runner.CheckBinary(o.conf.CollectorBinary); err != nil {
+			return err
+		}
+	}
+	collector, err := o.registerCollector(defaultCollector, o.conf.CollectorBinary)
+	if err != nil {
+		return err
+	}
+	o.stat.Version = collector.Version
+	for _, c := range o.conf.Collectors {
+		if err = validateCollector(c); err != nil {
+			return err
+		}
+		if _, ok := o.getCollector(c.Name); ok {
+			return errors.New("collector " + c.Name + " is defined more than once")
+		}
+		if _, err = o.registerCollector(c.Name, c.Binary); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateCollector(c config.CollectorConfig) error {
+	if !collectorName.MatchString(c.Name) {
+		return fmt.Errorf("invalid collector name %q", c.Name)
+	}
+	if c.Name == defaultCollector {
+		return errors.New("collector name " + defaultCollector + " is reserved")
+	}
+	return runner.CheckBinary(c.Binary)
+}
+
+func (o *OltpInf) getCollector(name string) (Collector, bool) {
+	o.collectorsMutex.RLock()
+	defer o.collectorsMutex.RUnlock()
+	c, ok := o.collectors[name]
+	return c, ok
+}
+
+// collectorBinary returns the binary of the collector selected by a policy.
+func (o *OltpInf) collectorBinary(name string) (string, error) {
+	if name == "" {
+		name = defaultCollector
+	}
+	c, ok := o.getCollector(name)
+	if !ok {
+		return "", errors.New("collector " + name + " not found")
+	}
+	return c.Binary, nil
+}
+
+func (o *OltpInf) getCollectors(c *gin.Context) {
+	o.collectorsMutex.RLock()
+	collectors := make([]Collector, 0, len(o.collectors))
+	for _, collector := range o.collectors {
+		collectors = append(collectors, collector)
+	}
+	o.collectorsMutex.RUnlock()
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].Name < collectors[j].Name
+	})
+	c.IndentedJSON(http.StatusOK, collectors)
+}
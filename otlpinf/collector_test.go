@@ -0,0 +1,124 @@
+package otlpinf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+	"go.uber.org/zap/zaptest"
+)
+
+// TEST_COLLECTOR is a canary collector distribution that only knows the otlp receiver and debug exporter.
+const TEST_COLLECTOR = `#!/bin/sh
+if [ "$1" = "components" ]; then
+  printf 'buildinfo:\n  command: otelcol-canary\n  version: 0.200.0\nreceivers:\n  - name: otlp\nexporters:\n  - name: debug\n'
+  exit 0
+fi
+echo "Everything is ready" >&2
+exec sleep 60
+`
+
+func writeTestCollector(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "otelcol-canary")
+	if err := os.WriteFile(path, []byte(TEST_COLLECTOR), 0o755); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestValidateCollector(t *testing.T) {
+	// Arrange
+	binary := writeTestCollector(t)
+
+	// Act and Assert
+	if err := validateCollector(config.CollectorConfig{Name: "canary", Binary: binary}); err != nil {
+		t.Errorf("validateCollector() error = %v", err)
+	}
+	for _, invalid := range []config.CollectorConfig{
+		{Name: defaultCollector, Binary: binary},
+		{Name: "canary/1", Binary: binary},
+		{Name: "canary", Binary: "otelcol-canary"},
+	} {
+		if err := validateCollector(invalid); err == nil {
+			t.Errorf("Expected an invalid collector error for %+v, but got none", invalid)
+		}
+	}
+}
+
+func TestOtlpInfCollectors(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	binary := writeTestCollector(t)
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55696,
+		},
+		Collectors: []config.CollectorConfig{{Name: "canary", Binary: binary}},
+	}
+
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		otlp.router.ServeHTTP(w, req)
+		return w
+	}
+	policy := strings.Replace(TEST_REVISION_POLICY, "%s", "basic", 1)
+
+	// Act list collectors
+	w := send("GET", "/api/v1/collectors", "")
+	var collectors []Collector
+	err = json.Unmarshal(w.Body.Bytes(), &collectors)
+
+	// Assert
+	if err != nil {
+		t.Errorf("json.Unmarshal() error = %v", err)
+	}
+	if len(collectors) != 2 || collectors[0].Name != "canary" || collectors[1].Name != defaultCollector {
+		t.Fatalf("Expected canary and default collectors, got %+v", collectors)
+	}
+	if collectors[0].Version != "0.200.0" || collectors[0].Default || strings.Join(collectors[0].Components["receivers"], ",") != "otlp" {
+		t.Errorf("Expected the canary collector version and components, got %+v", collectors[0])
+	}
+	if !collectors[1].Default || collectors[1].Version != otlp.stat.Version {
+		t.Errorf("Expected the default collector to have the otlpinf version, got %+v", collectors[1])
+	}
+
+	// Act create policy on a missing collector
+	w = send("POST", POLICIES_API, strings.Replace(policy, "  config:", "  collector: missing\n  config:", 1))
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+
+	// Act create policy on the canary collector
+	w = send("POST", POLICIES_API, strings.Replace(policy, "  config:", "  collector: canary\n  config:", 1))
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+	if status := otlp.policies["policy_test"].Instance.GetStatus(); status.Status != runner.Running {
+		t.Errorf("Expected policy to be running on the canary collector, got %v", status.StatusText)
+	}
+}
@@ -0,0 +1,201 @@
+package otlpinf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines shown around every change.
+	diffContext = 3
+	// maxDiffCells bounds the product of the line counts of the parts of two texts that differ,
+	// which the time of a diff is proportional to.
+	maxDiffCells = 1 << 26
+)
+
+var errDiffTooLarge = errors.New("the texts differ on too many lines to be diffed")
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// unifiedDiff returns the differences between the lines of a and b in the unified format, or an
+// empty string when they are equal.
+func unifiedDiff(fromName string, toName string, a string, b string) (string, error) {
+	lines, err := diffLines(splitLines(a), splitLines(b))
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for start := 0; start < len(lines); {
+		// find the next change and the extent of its hunk
+		first := start
+		for first < len(lines) && lines[first].op == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		begin := first - diffContext
+		if begin < start {
+			begin = start
+		}
+		end := first
+		for unchanged := 0; end < len(lines) && unchanged <= 2*diffContext; end++ {
+			if lines[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		for end > first && lines[end-1].op == ' ' {
+			end--
+		}
+		if end += diffContext; end > len(lines) {
+			end = len(lines)
+		}
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&out, lines, begin, end)
+		start = end
+	}
+	return out.String(), nil
+}
+
+func writeHunk(out *strings.Builder, lines []diffLine, begin int, end int) {
+	aStart, bStart := 1, 1
+	for _, l := range lines[:begin] {
+		if l.op != '+' {
+			aStart++
+		}
+		if l.op != '-' {
+			bStart++
+		}
+	}
+	aLen, bLen := 0, 0
+	for _, l := range lines[begin:end] {
+		if l.op != '+' {
+			aLen++
+		}
+		if l.op != '-' {
+			bLen++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+	for _, l := range lines[begin:end] {
+		out.WriteByte(l.op)
+		out.WriteString(l.text)
+		out.WriteByte('\n')
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines aligns a and b by their longest common subsequence. The lines they start and end
+// with are aligned first, so that only the part in between is bounded by maxDiffCells.
+func diffLines(a []string, b []string) ([]diffLine, error) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	if int64(len(a)-prefix-suffix)*int64(len(b)-prefix-suffix) > maxDiffCells {
+		return nil, errDiffTooLarge
+	}
+	lines := make([]diffLine, 0, len(a)+len(b)-prefix-suffix)
+	for _, l := range a[:prefix] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	lines = alignLines(lines, a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', l})
+	}
+	return lines, nil
+}
+
+// alignLines appends the alignment of a and b to lines, computing their longest common
+// subsequence in linear space with Hirschberg's algorithm: a is split in half and b where the
+// subsequences of both halves are the longest.
+func alignLines(lines []diffLine, a []string, b []string) []diffLine {
+	switch {
+	case len(a) == 0:
+		for _, l := range b {
+			lines = append(lines, diffLine{'+', l})
+		}
+		return lines
+	case len(b) == 0:
+		for _, l := range a {
+			lines = append(lines, diffLine{'-', l})
+		}
+		return lines
+	case len(a) == 1:
+		for j, l := range b {
+			if l == a[0] {
+				lines = alignLines(lines, nil, b[:j])
+				lines = append(lines, diffLine{' ', l})
+				return alignLines(lines, nil, b[j+1:])
+			}
+		}
+		lines = append(lines, diffLine{'-', a[0]})
+		return alignLines(lines, nil, b)
+	}
+	mid := len(a) / 2
+	head := lcsLengths(a[:mid], b, false)
+	tail := lcsLengths(a[mid:], b, true)
+	split, longest := 0, -1
+	for j := range head {
+		if l := head[j] + tail[j]; l > longest {
+			split, longest = j, l
+		}
+	}
+	lines = alignLines(lines, a[:mid], b[:split])
+	return alignLines(lines, a[mid:], b[split:])
+}
+
+// lcsLengths returns, for every j, the length of the longest common subsequence of a and b[:j],
+// or of a and b[j:] when reverse is set.
+func lcsLengths(a []string, b []string, reverse bool) []int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for i := range a {
+		if reverse {
+			line := a[len(a)-1-i]
+			for j := len(b) - 1; j >= 0; j-- {
+				if line == b[j] {
+					cur[j] = prev[j+1] + 1
+				} else {
+					cur[j] = maxInt(prev[j], cur[j+1])
+				}
+			}
+		} else {
+			line := a[i]
+			for j := 1; j <= len(b); j++ {
+				if line == b[j-1] {
+					cur[j] = prev[j-1] + 1
+				} else {
+					cur[j] = maxInt(prev[j], cur[j-1])
+				}
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
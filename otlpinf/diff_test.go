@@ -0,0 +1,87 @@
+package otlpinf
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	// Arrange
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	b := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+
+	// Act
+	d, err := unifiedDiff("old", "new", a, b)
+
+	// Assert
+	expected := "--- old\n+++ new\n" +
+		"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+		"@@ -8,3 +8,4 @@\n h\n i\n j\n+k\n"
+	if err != nil || d != expected {
+		t.Errorf("Expected diff\n%v\ngot\n%v", expected, d)
+	}
+
+	// Act equal texts
+	d, err = unifiedDiff("old", "new", a, a)
+
+	// Assert
+	if err != nil || d != "" {
+		t.Errorf("Expected no diff, got %v", d)
+	}
+}
+
+func TestDiffLinesLongestCommonSubsequence(t *testing.T) {
+	// Arrange
+	a := strings.Split("a b c a b b a", " ")
+	b := strings.Split("c b a b a c", " ")
+
+	// Act
+	lines, err := diffLines(a, b)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("diffLines() error = %v", err)
+	}
+	var from, to []string
+	common := 0
+	for _, l := range lines {
+		if l.op != '+' {
+			from = append(from, l.text)
+		}
+		if l.op != '-' {
+			to = append(to, l.text)
+		}
+		if l.op == ' ' {
+			common++
+		}
+	}
+	if strings.Join(from, " ") != strings.Join(a, " ") || strings.Join(to, " ") != strings.Join(b, " ") || common != 4 {
+		t.Errorf("Expected an alignment of a and b with 4 common lines, got %v", lines)
+	}
+}
+
+func TestDiffLinesBound(t *testing.T) {
+	// Arrange
+	var a, b []string
+	for i := 0; i < 10000; i++ {
+		a = append(a, "a"+strconv.Itoa(i))
+		b = append(b, "b"+strconv.Itoa(i))
+	}
+
+	// Act long texts differing on a single line
+	lines, err := diffLines(append([]string{"x"}, a...), append([]string{"y"}, a...))
+
+	// Assert
+	if err != nil || len(lines) != len(a)+2 {
+		t.Errorf("Expected a diff of %d lines, got %d lines and error %v", len(a)+2, len(lines), err)
+	}
+
+	// Act long texts differing on every line
+	_, err = diffLines(a, b)
+
+	// Assert
+	if err != errDiffTooLarge {
+		t.Errorf("Expected error %v, got %v", errDiffTooLarge, err)
+	}
+}
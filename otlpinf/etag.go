@@ -0,0 +1,59 @@
+package otlpinf
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// policyETag is the strong entity tag of the reply of a policy: the policy version, the status of
+// its collector, which changes without a new version, and whether the policy is rendered. The
+// process stats of the reply are left out, so that polling a policy does not send every sample.
+func policyETag(version int64, status string, rendered bool) string {
+	tag := strconv.FormatInt(version, 10) + "-" + status
+	if rendered {
+		tag += "-rendered"
+	}
+	return `"` + tag + `"`
+}
+
+// matchETag reports whether an If-Match or If-None-Match header value matches etag. If-Match
+// compares strongly, so a weak tag never matches, while If-None-Match compares weakly.
+func matchETag(header string, etag string, weak bool) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if weak {
+			t = strings.TrimPrefix(t, "W/")
+		}
+		if t == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPreconditions evaluates If-Match and If-None-Match against the current policy, which
+// exists tells whether there is one, replying with 412 when they fail.
+func checkPreconditions(c *gin.Context, current RunnerInfo, exists bool) bool {
+	etag := ""
+	if exists {
+		etag = policyETag(current.Version, current.Instance.GetStatus().StatusText, false)
+	}
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" && (!exists || !matchETag(ifMatch, etag, false)) {
+		c.IndentedJSON(http.StatusPreconditionFailed, ReturnValue{"policy does not match If-Match"})
+		return false
+	}
+	if ifNoneMatch := c.GetHeader("If-None-Match"); exists && matchETag(ifNoneMatch, etag, true) {
+		c.IndentedJSON(http.StatusPreconditionFailed, ReturnValue{"policy matches If-None-Match"})
+		return false
+	}
+	return true
+}
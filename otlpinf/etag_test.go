@@ -0,0 +1,157 @@
+package otlpinf
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestOtlpInfPolicyETags(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55690,
+		},
+	}
+
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+
+	send := func(method string, path string, body string, header string, value string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		otlp.router.ServeHTTP(w, req)
+		return w
+	}
+	policyAPI := POLICIES_API + "/policy_test"
+	basic := strings.Replace(TEST_REVISION_POLICY, "%s", "basic", 1)
+	detailed := strings.Replace(TEST_REVISION_POLICY, "%s", "detailed", 1)
+
+	// Act create policy only if it does not exist
+	w := send("POST", POLICIES_API, basic, "If-None-Match", "*")
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"1-running"` {
+		t.Errorf("Expected ETag \"1-running\", got %v", etag)
+	}
+
+	// Act create existing policy only if it does not exist
+	w = send("POST", POLICIES_API, basic, "If-None-Match", "*")
+
+	// Assert
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusPreconditionFailed)
+	}
+
+	// Act get unchanged policy
+	w = send("GET", policyAPI, "", "If-None-Match", `W/"1-running"`)
+
+	// Assert
+	if w.Code != http.StatusNotModified {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusNotModified)
+	}
+
+	// Act get rendered policy with the tag of the policy
+	w = send("GET", policyAPI+"?rendered=true", "", "If-None-Match", `"1-running"`)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"1-running-rendered"` {
+		t.Errorf("Expected ETag \"1-running-rendered\", got %v", etag)
+	}
+
+	// Act get paused policy
+	send("POST", policyAPI+"/pause", "", "", "")
+	w = send("GET", policyAPI, "", "If-None-Match", `"1-running"`)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"1-paused"` {
+		t.Errorf("Expected ETag \"1-paused\", got %v", etag)
+	}
+
+	// Act update stale policy
+	w = send("PUT", policyAPI, detailed, "If-Match", `"1-running"`)
+
+	// Assert
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusPreconditionFailed)
+	}
+
+	// Act update policy with a weak tag
+	w = send("PUT", policyAPI, detailed, "If-Match", `W/"1-paused"`)
+
+	// Assert
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusPreconditionFailed)
+	}
+
+	// Act update current policy
+	w = send("PUT", policyAPI, detailed, "If-Match", `"1-paused"`)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"2-running"` {
+		t.Errorf("Expected ETag \"2-running\", got %v", etag)
+	}
+	if !strings.Contains(w.Body.String(), "generation: 2") {
+		t.Errorf("Expected generation 2 in body, got %v", w.Body.String())
+	}
+
+	// Act delete stale policy
+	w = send("DELETE", policyAPI, "", "If-Match", `"1-paused"`)
+
+	// Assert
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusPreconditionFailed)
+	}
+
+	// Act delete current policy
+	w = send("DELETE", policyAPI, "", "If-Match", `"1-paused", "2-running"`)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+
+	// Act update policy created again with an ETag of the deleted one
+	send("POST", POLICIES_API, basic, "", "")
+	w = send("PUT", policyAPI, detailed, "If-Match", `"1-running"`)
+
+	// Assert
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusPreconditionFailed)
+	}
+	w = send("GET", policyAPI, "", "", "")
+	if etag := w.Header().Get("ETag"); etag != `"3-running"` || !strings.Contains(w.Body.String(), "generation: 1") {
+		t.Errorf("Expected ETag \"3-running\" of generation 1, got %v", etag)
+	}
+}
@@ -0,0 +1,331 @@
+package otlpinf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeBehaviour is how the collector of a fake runner behaves.
+type fakeBehaviour struct {
+	// startErr fails every start with this error
+	startErr error
+	// startDelay is how long a start takes
+	startDelay time.Duration
+	// crashAfter makes the collector crash this long after it started
+	crashAfter time.Duration
+}
+
+// fakeRunner is a Runner without a collector process, so that the REST API can be tested
+// without starting one.
+type fakeRunner struct {
+	fakeBehaviour
+	// settings are the settings the runner was created with
+	settings RunnerSettings
+	mutex    sync.Mutex
+	policy   config.Policy
+	state    runner.State
+	logs     []string
+	starts   int
+	stop     chan struct{}
+}
+
+func (f *fakeRunner) Configure(c *config.Policy) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.policy = *c
+	return nil
+}
+
+func (f *fakeRunner) Start(ctx context.Context, cancelFunc context.CancelFunc) error {
+	if f.startDelay > 0 {
+		select {
+		case <-time.After(f.startDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.starts++
+	if f.startErr != nil {
+		cancelFunc()
+		f.setStatus(runner.RunnerError)
+		f.state.LastError = f.startErr.Error()
+		f.logs = append(f.logs, f.startErr.Error())
+		return f.startErr
+	}
+	f.setStatus(runner.Running)
+	f.logs = append(f.logs, "Everything is ready")
+	stop := make(chan struct{})
+	f.stop = stop
+	if f.crashAfter > 0 {
+		go func() {
+			select {
+			case <-time.After(f.crashAfter):
+				f.mutex.Lock()
+				defer f.mutex.Unlock()
+				f.setStatus(runner.RunnerError)
+				f.state.LastError = "collector crashed"
+				f.logs = append(f.logs, f.state.LastError)
+				cancelFunc()
+			case <-stop:
+				cancelFunc()
+			}
+		}()
+	}
+	return nil
+}
+
+func (f *fakeRunner) Stop(_ context.Context) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.stop != nil {
+		close(f.stop)
+		f.stop = nil
+	}
+	f.setStatus(runner.Offline)
+}
+
+func (f *fakeRunner) Pause(ctx context.Context) {
+	f.Stop(ctx)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.setStatus(runner.Paused)
+}
+
+func (f *fakeRunner) Restart(ctx context.Context, cancelFunc context.CancelFunc) error {
+	f.Stop(ctx)
+	f.mutex.Lock()
+	f.state.RestartCount++
+	f.state.LastRestartTS = time.Now()
+	f.mutex.Unlock()
+	return f.Start(ctx, cancelFunc)
+}
+
+func (f *fakeRunner) GetStatus() runner.State {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.state
+}
+
+func (f *fakeRunner) Logs() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	logs := make([]string, len(f.logs))
+	copy(logs, f.logs)
+	return logs
+}
+
+func (f *fakeRunner) Stats() (runner.ProcessStats, error) {
+	if f.GetStatus().Status != runner.Running {
+		return runner.ProcessStats{}, runner.ErrNotRunning
+	}
+	return runner.ProcessStats{PID: 1}, nil
+}
+
+func (f *fakeRunner) configured() config.Policy {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.policy
+}
+
+func (f *fakeRunner) startCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.starts
+}
+
+func (f *fakeRunner) setStatus(s runner.Status) {
+	f.state.Status = s
+	f.state.StatusText = runner.MapStatus[s]
+}
+
+// fakeRunners creates fake runners behaving as set for their policy.
+type fakeRunners struct {
+	mutex     sync.Mutex
+	behaviour map[string]fakeBehaviour
+	created   map[string][]*fakeRunner
+}
+
+func newFakeRunners() *fakeRunners {
+	return &fakeRunners{behaviour: make(map[string]fakeBehaviour), created: make(map[string][]*fakeRunner)}
+}
+
+func (f *fakeRunners) set(policy string, b fakeBehaviour) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.behaviour[policy] = b
+}
+
+func (f *fakeRunners) factory(policy string, settings RunnerSettings) Runner {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	r := &fakeRunner{fakeBehaviour: f.behaviour[policy], settings: settings}
+	f.created[policy] = append(f.created[policy], r)
+	return r
+}
+
+func (f *fakeRunners) runners(policy string) []*fakeRunner {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.created[policy]
+}
+
+func TestOtlpInfFakeRunner(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	fakes := newFakeRunners()
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55698,
+		},
+		CollectorBinary: writeTestCollector(t),
+	}
+
+	otlp, err := New(logger, &cfg, WithRunnerFactory(fakes.factory))
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		otlp.router.ServeHTTP(w, req)
+		return w
+	}
+	policy := func(name string) string {
+		return strings.Replace(strings.Replace(TEST_REVISION_POLICY, "%s", "basic", 1), "policy_test", name, 1)
+	}
+	fakes.set("failing", fakeBehaviour{startErr: &runner.StartError{Phase: runner.PhaseStart, Kind: "receiver", Component: "otlp",
+		Cause: "listen tcp 0.0.0.0:4318: bind: address already in use"}})
+	fakes.set("slow", fakeBehaviour{startDelay: 50 * time.Millisecond})
+	fakes.set("crashing", fakeBehaviour{crashAfter: 10 * time.Millisecond})
+
+	// Act create policy failing to start
+	w := send("POST", POLICIES_API, policy("failing"))
+	var reply ReturnStartError
+	err = json.Unmarshal(w.Body.Bytes(), &reply)
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+	if err != nil || reply.Error == nil || reply.Error.Kind != "receiver" || reply.Error.Component != "otlp" ||
+		reply.Error.Cause != "listen tcp 0.0.0.0:4318: bind: address already in use" {
+		t.Errorf("Expected the structured startup failure, got %s", w.Body.String())
+	}
+	if _, ok := otlp.getRunnerInfo("failing"); ok {
+		t.Errorf("Expected the failing policy not to be created")
+	}
+
+	// Act create slow starting policy
+	start := time.Now()
+	w = send("POST", POLICIES_API, policy("slow"))
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected the policy to be created once started, got %v", elapsed)
+	}
+	if status := otlp.policies["slow"].Instance.GetStatus(); status.Status != runner.Running {
+		t.Errorf("Expected slow policy to be running, got %v", status.StatusText)
+	}
+
+	// Act create crashing policy
+	w = send("POST", POLICIES_API, policy("crashing"))
+	crashed := false
+	for i := 0; i < 100 && !crashed; i++ {
+		time.Sleep(5 * time.Millisecond)
+		crashed = strings.Contains(send("GET", POLICIES_API+"/crashing", "").Body.String(), "runner_error")
+	}
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+	if !crashed {
+		t.Errorf("Expected crashing policy to report a runner error")
+	}
+
+	// Act update slow policy with a failing collector
+	fakes.set("slow", fakeBehaviour{startErr: errors.New("invalid configuration")})
+	w = send("PUT", POLICIES_API+"/slow", policy("slow"))
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+	runners := fakes.runners("slow")
+	if len(runners) != 2 || runners[0].startCount() != 2 || runners[0].GetStatus().Status != runner.Running {
+		t.Errorf("Expected the previous runner to be started again, got %d runners", len(runners))
+	}
+	if otlp.policies["slow"].Instance != runners[0] {
+		t.Errorf("Expected the previous runner to be kept")
+	}
+}
+
+func TestOtlpInfFakeRunnerSettings(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	fakes := newFakeRunners()
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55703,
+		},
+		PolicyDefaults: config.PolicyDefaults{StartupTimeout: 2 * time.Second},
+	}
+
+	otlp, err := New(logger, &cfg, WithRunnerFactory(fakes.factory))
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+
+	// Act create policy with limits
+	w := httptest.NewRecorder()
+	body := strings.Replace(strings.Replace(TEST_REVISION_POLICY, "%s", "basic", 1), "  config:", "  limits:\n    open_files: 1024\n  config:", 1)
+	req, _ := http.NewRequest("POST", POLICIES_API, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Fatalf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+	runners := fakes.runners("policy_test")
+	if len(runners) != 1 {
+		t.Fatalf("Expected one runner for the policy, got %d", len(runners))
+	}
+	if settings := runners[0].settings; settings.Binary != "" || settings.StartupTimeout != 2*time.Second {
+		t.Errorf("Expected the embedded collector with the default startup timeout, got %+v", settings)
+	}
+	if limits := runners[0].configured().Limits; limits == nil || limits.OpenFiles != 1024 {
+		t.Errorf("Expected the policy limits to be configured, got %v", limits)
+	}
+}
@@ -0,0 +1,205 @@
+package otlpinf
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/config"
+)
+
+// includeFragments returns the policy with the config of the fragments it includes merged into
+// its own, and no include left. Fragments are merged in order: maps are merged key by key, and two
+// fragments setting any other value differently conflict, as fragments must not depend on their
+// order. The policy config is merged last and overrides the values of the fragments. A null value
+// never overrides another.
+func (o *OltpInf) includeFragments(p config.Policy) (config.Policy, error) {
+	if len(p.Include) == 0 {
+		return p, nil
+	}
+	o.fragmentsMutex.RLock()
+	defer o.fragmentsMutex.RUnlock()
+	merged := make(map[string]interface{})
+	owners := make(map[string]string)
+	seen := make(map[string]bool, len(p.Include))
+	for _, name := range p.Include {
+		if seen[name] {
+			return p, fmt.Errorf("fragment %s is included more than once", name)
+		}
+		seen[name] = true
+		f, ok := o.fragments[name]
+		if !ok {
+			return p, fmt.Errorf("fragment %s not found", name)
+		}
+		if err := mergeConfig(merged, f.Config, "", name, owners); err != nil {
+			return p, err
+		}
+	}
+	if err := mergeConfig(merged, p.Config, "", "", owners); err != nil {
+		return p, err
+	}
+	p.Config = merged
+	p.Include = nil
+	return p, nil
+}
+
+// mergeConfig merges src into dst. Values set by a fragment, named by source, are recorded in
+// owners by path so that another fragment setting them differently is reported. An empty source
+// is the policy config, which overrides the fragments.
+func mergeConfig(dst map[string]interface{}, src map[string]interface{}, path string, source string, owners map[string]string) error {
+	for k, v := range src {
+		p := k
+		if path != "" {
+			p = path + "::" + k
+		}
+		current, ok := dst[k]
+		if v == nil && ok {
+			continue
+		}
+		currentMap, currentIsMap := current.(map[string]interface{})
+		srcMap, srcIsMap := v.(map[string]interface{})
+		switch {
+		case !ok || current == nil:
+			dst[k] = deepCopy(v)
+			owners[p] = source
+		case currentIsMap && srcIsMap:
+			if err := mergeConfig(currentMap, srcMap, p, source, owners); err != nil {
+				return err
+			}
+		case source == "":
+			dst[k] = deepCopy(v)
+		case !reflect.DeepEqual(current, v):
+			return fmt.Errorf("fragments %s and %s conflict on %s", ownerOf(owners, p), source, p)
+		}
+	}
+	return nil
+}
+
+// ownerOf returns the fragment that set path or the map holding it.
+func ownerOf(owners map[string]string, path string) string {
+	for p := path; ; {
+		if owner, ok := owners[p]; ok {
+			return owner
+		}
+		i := strings.LastIndex(p, "::")
+		if i < 0 {
+			return ""
+		}
+		p = p[:i]
+	}
+}
+
+// deepCopy copies the maps and lists of a YAML value.
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i, e := range t {
+			l[i] = deepCopy(e)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// includedBy returns the sorted policies including a fragment.
+func (o *OltpInf) includedBy(fragment string) []string {
+	o.policiesMutex.RLock()
+	defer o.policiesMutex.RUnlock()
+	policies := make([]string, 0)
+	for name, rInfo := range o.policies {
+		for _, f := range rInfo.Policy.Include {
+			if f == fragment {
+				policies = append(policies, name)
+				break
+			}
+		}
+	}
+	sort.Strings(policies)
+	return policies
+}
+
+func (o *OltpInf) getFragments(c *gin.Context) {
+	o.fragmentsMutex.RLock()
+	defer o.fragmentsMutex.RUnlock()
+	fragments := make([]string, 0, len(o.fragments))
+	for k := range o.fragments {
+		fragments = append(fragments, k)
+	}
+	sort.Strings(fragments)
+	c.IndentedJSON(http.StatusOK, fragments)
+}
+
+func (o *OltpInf) getFragment(c *gin.Context) {
+	name := c.Param("fragment")
+	o.fragmentsMutex.RLock()
+	f, ok := o.fragments[name]
+	o.fragmentsMutex.RUnlock()
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"fragment not found"})
+		return
+	}
+	o.replyYAML(c, http.StatusOK, map[string]config.Fragment{name: f})
+}
+
+func (o *OltpInf) createFragment(c *gin.Context) {
+	var payload map[string]config.Fragment
+	if !bindYAML(c, &payload) {
+		return
+	}
+	if len(payload) != 1 {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"only single fragment allowed per request"})
+		return
+	}
+	for name, f := range payload {
+		if !collectorName.MatchString(name) {
+			c.IndentedJSON(http.StatusBadRequest, ReturnValue{fmt.Sprintf("invalid fragment name %q", name)})
+			return
+		}
+		if len(f.Config) == 0 {
+			c.IndentedJSON(http.StatusBadRequest, ReturnValue{"fragment config field is required"})
+			return
+		}
+		o.fragmentsMutex.Lock()
+		_, exists := o.fragments[name]
+		if !exists {
+			o.fragments[name] = f
+		}
+		o.fragmentsMutex.Unlock()
+		if exists {
+			c.IndentedJSON(http.StatusConflict, ReturnValue{"fragment already exists"})
+			return
+		}
+		o.replyYAML(c, http.StatusCreated, map[string]config.Fragment{name: f})
+	}
+}
+
+// deleteFragment deletes a fragment unless a policy includes it.
+func (o *OltpInf) deleteFragment(c *gin.Context) {
+	name := c.Param("fragment")
+	// policies only change while holding writeMutex, so none can include the fragment meanwhile
+	o.writeMutex.Lock()
+	defer o.writeMutex.Unlock()
+	if policies := o.includedBy(name); len(policies) > 0 {
+		c.IndentedJSON(http.StatusConflict, ReturnValue{"fragment is included by policies " + strings.Join(policies, ", ")})
+		return
+	}
+	o.fragmentsMutex.Lock()
+	defer o.fragmentsMutex.Unlock()
+	if _, ok := o.fragments[name]; !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"fragment not found"})
+		return
+	}
+	delete(o.fragments, name)
+	c.IndentedJSON(http.StatusOK, ReturnValue{name + " was deleted"})
+}
@@ -0,0 +1,258 @@
+package otlpinf
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"go.uber.org/zap/zaptest"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FRAGMENTS_API  = "/api/v1/fragments"
+	TEST_FRAGMENTS = `base:
+  config:
+    processors:
+      batch:
+        timeout: 5s
+    exporters:
+      debug:
+        verbosity: basic
+`
+	TEST_FRAGMENT_POLICY = `policy_fragment:
+  include: [base]
+  config:
+    receivers:
+      otlp:
+        protocols:
+          http:
+    exporters:
+      debug:
+        verbosity: detailed
+    service:
+      pipelines:
+        traces:
+          receivers: [otlp]
+          processors: [batch]
+          exporters: [debug]
+`
+)
+
+func TestIncludeFragments(t *testing.T) {
+	// Arrange
+	o := OltpInf{fragmentsMutex: &sync.RWMutex{}}
+	o.fragments = map[string]config.Fragment{
+		"batch": {Config: map[string]interface{}{
+			"processors": map[string]interface{}{"batch": map[string]interface{}{"timeout": "5s"}},
+		}},
+		"batch_size": {Config: map[string]interface{}{
+			"processors": map[string]interface{}{"batch": map[string]interface{}{"send_batch_size": 100}},
+		}},
+		"batch_slow": {Config: map[string]interface{}{
+			"processors": map[string]interface{}{"batch": map[string]interface{}{"timeout": "30s"}},
+		}},
+		"batch_same": {Config: map[string]interface{}{
+			"processors": map[string]interface{}{"batch": map[string]interface{}{"timeout": "5s"}},
+		}},
+		"pipelines": {Config: map[string]interface{}{
+			"service": map[string]interface{}{"pipelines": map[string]interface{}{
+				"traces": map[string]interface{}{"exporters": []interface{}{"debug"}},
+			}},
+		}},
+	}
+	tests := []struct {
+		name     string
+		include  []string
+		config   map[string]interface{}
+		expected map[string]interface{}
+		err      string
+	}{
+		{
+			name:    "fragments maps merge",
+			include: []string{"batch", "batch_size"},
+			expected: map[string]interface{}{
+				"processors": map[string]interface{}{"batch": map[string]interface{}{"timeout": "5s", "send_batch_size": 100}},
+			},
+		},
+		{
+			name:    "equal values do not conflict",
+			include: []string{"batch", "batch_same"},
+			expected: map[string]interface{}{
+				"processors": map[string]interface{}{"batch": map[string]interface{}{"timeout": "5s"}},
+			},
+		},
+		{
+			name:    "fragments values conflict",
+			include: []string{"batch", "batch_slow"},
+			err:     "fragments batch and batch_slow conflict on processors::batch::timeout",
+		},
+		{
+			name:    "policy overrides fragments",
+			include: []string{"batch", "pipelines"},
+			config: map[string]interface{}{
+				"processors": map[string]interface{}{"batch": map[string]interface{}{"timeout": "1s"}},
+				"service": map[string]interface{}{"pipelines": map[string]interface{}{
+					"traces": map[string]interface{}{"exporters": []interface{}{"otlp"}, "receivers": nil},
+				}},
+			},
+			expected: map[string]interface{}{
+				"processors": map[string]interface{}{"batch": map[string]interface{}{"timeout": "1s"}},
+				"service": map[string]interface{}{"pipelines": map[string]interface{}{
+					"traces": map[string]interface{}{"exporters": []interface{}{"otlp"}, "receivers": nil},
+				}},
+			},
+		},
+		{
+			name:    "unknown fragment",
+			include: []string{"missing"},
+			err:     "fragment missing not found",
+		},
+		{
+			name:    "fragment included twice",
+			include: []string{"batch", "batch"},
+			err:     "fragment batch is included more than once",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			p, err := o.includeFragments(config.Policy{Include: tt.include, Config: tt.config})
+
+			// Assert
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, but got %v", err)
+			}
+			if !reflect.DeepEqual(p.Config, tt.expected) {
+				t.Errorf("Expected config %v, got %v", tt.expected, p.Config)
+			}
+			if p.Include != nil {
+				t.Errorf("Expected no include left, got %v", p.Include)
+			}
+		})
+	}
+	batch := o.fragments["batch"].Config["processors"].(map[string]interface{})["batch"].(map[string]interface{})
+	if batch["timeout"] != "5s" || len(batch) != 1 {
+		t.Errorf("Expected the fragments to be left unchanged, got %v", batch)
+	}
+}
+
+func TestOtlpInfFragments(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55701,
+		},
+		CollectorBinary: writeTestCollector(t),
+	}
+	fakes := newFakeRunners()
+	otlp, err := New(logger, &cfg, WithRunnerFactory(fakes.factory))
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		otlp.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Act create policy including a missing fragment
+	w := send("POST", POLICIES_API, TEST_FRAGMENT_POLICY)
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+
+	// Act create fragment
+	w = send("POST", FRAGMENTS_API, TEST_FRAGMENTS)
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+
+	// Act create existing fragment
+	w = send("POST", FRAGMENTS_API, TEST_FRAGMENTS)
+
+	// Assert
+	if w.Code != http.StatusConflict {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusConflict)
+	}
+
+	// Act create policy
+	w = send("POST", POLICIES_API, TEST_FRAGMENT_POLICY)
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Fatalf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+	configured := fakes.runners("policy_fragment")[0].configured()
+	processors, _ := configured.Config["processors"].(map[string]interface{})
+	if _, ok := processors["batch"]; !ok || configured.Include != nil {
+		t.Errorf("Expected the runner to be configured with the fragment merged, got %v", configured)
+	}
+
+	// Act get policy and rendered policy
+	w = send("GET", POLICIES_API+"/policy_fragment", "")
+	r := send("GET", POLICIES_API+"/policy_fragment?rendered=true", "")
+	var policy, rendered map[string]ReturnPolicyData
+	_ = yaml.Unmarshal(w.Body.Bytes(), &policy)
+	_ = yaml.Unmarshal(r.Body.Bytes(), &rendered)
+
+	// Assert
+	if w.Code != http.StatusOK || r.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, r.Code, http.StatusOK)
+	}
+	if got := policy["policy_fragment"].Policy; len(got.Include) != 1 || got.Config["processors"] != nil {
+		t.Errorf("Expected the policy as defined, got %v", got)
+	}
+	got := rendered["policy_fragment"].Policy
+	debug, _ := got.Config["exporters"].(map[string]interface{})["debug"].(map[string]interface{})
+	if len(got.Include) != 0 || got.Config["processors"] == nil || debug["verbosity"] != "detailed" {
+		t.Errorf("Expected the rendered policy with the policy values kept, got %v", got)
+	}
+
+	// Act delete included fragment
+	w = send("DELETE", FRAGMENTS_API+"/base", "")
+
+	// Assert
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "policy_fragment") {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusConflict)
+	}
+
+	// Act delete fragment after its policy
+	send("DELETE", POLICIES_API+"/policy_fragment", "")
+	w = send("DELETE", FRAGMENTS_API+"/base", "")
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	w = send("GET", FRAGMENTS_API+"/base", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusNotFound)
+	}
+}
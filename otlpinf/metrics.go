@@ -0,0 +1,85 @@
+package otlpinf
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+)
+
+type metric struct {
+	name   string
+	kind   string
+	help   string
+	values []metricValue
+}
+
+type metricValue struct {
+	labels string
+	value  float64
+}
+
+// getMetrics replies with otlpinf metrics in the Prometheus text exposition format.
+func (o *OltpInf) getMetrics(c *gin.Context) {
+	policies := &metric{name: "otlpinf_policies", kind: "gauge", help: "Number of policies by runner status."}
+	up := &metric{name: "otlpinf_policy_up", kind: "gauge", help: "Whether the collector of the policy is running."}
+	restarts := &metric{name: "otlpinf_policy_restarts_total", kind: "counter", help: "Restarts of the collector of the policy."}
+	cpu := &metric{name: "otlpinf_policy_cpu_seconds_total", kind: "counter", help: "User and system CPU time of the collector process."}
+	rss := &metric{name: "otlpinf_policy_resident_memory_bytes", kind: "gauge", help: "Resident memory of the collector process."}
+	fds := &metric{name: "otlpinf_policy_open_fds", kind: "gauge", help: "Open file descriptors of the collector process."}
+	threads := &metric{name: "otlpinf_policy_threads", kind: "gauge", help: "Threads of the collector process."}
+
+	o.policiesMutex.RLock()
+	names := make([]string, 0, len(o.policies))
+	for name := range o.policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	statuses := make(map[string]float64, len(runner.MapStatus))
+	for _, s := range runner.MapStatus {
+		statuses[s] = 0
+	}
+	for _, name := range names {
+		r := o.policies[name].Instance
+		state := r.GetStatus()
+		statuses[runner.MapStatus[state.Status]]++
+		labels := fmt.Sprintf(`policy="%s"`, escapeLabel(name))
+		running := 0.0
+		if state.Status == runner.Running {
+			running = 1
+		}
+		up.values = append(up.values, metricValue{labels, running})
+		restarts.values = append(restarts.values, metricValue{labels, float64(state.RestartCount)})
+		if stats, err := r.Stats(); err == nil {
+			cpu.values = append(cpu.values, metricValue{labels, stats.CPUSeconds})
+			rss.values = append(rss.values, metricValue{labels, float64(stats.RSSBytes)})
+			fds.values = append(fds.values, metricValue{labels, float64(stats.OpenFDs)})
+			threads.values = append(threads.values, metricValue{labels, float64(stats.Threads)})
+		}
+	}
+	o.policiesMutex.RUnlock()
+	keys := make([]string, 0, len(statuses))
+	for s := range statuses {
+		keys = append(keys, s)
+	}
+	sort.Strings(keys)
+	for _, s := range keys {
+		policies.values = append(policies.values, metricValue{fmt.Sprintf(`status="%s"`, s), statuses[s]})
+	}
+
+	var b strings.Builder
+	for _, m := range []*metric{policies, up, restarts, cpu, rss, fds, threads} {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, v := range m.values {
+			fmt.Fprintf(&b, "%s{%s} %g\n", m.name, v.labels, v.value)
+		}
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,90 @@
+package otlpinf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestOtlpInfPolicyStats(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55694,
+		},
+	}
+
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		otlp.router.ServeHTTP(w, req)
+		return w
+	}
+	policyAPI := POLICIES_API + "/policy_test"
+	if w := send("POST", POLICIES_API, strings.Replace(TEST_REVISION_POLICY, "%s", "basic", 1)); w.Code != http.StatusCreated {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+
+	// Act get stats
+	w := send("GET", policyAPI+"/stats", "")
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	var stats runner.ProcessStats
+	if err = json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Errorf("json.Unmarshal() error = %v", err)
+	}
+	if stats.PID == 0 || stats.RSSBytes == 0 {
+		t.Errorf("Expected collector process stats, got %+v", stats)
+	}
+
+	// Act get policy
+	w = send("GET", policyAPI, "")
+
+	// Assert
+	if !strings.Contains(w.Body.String(), "rss_bytes:") {
+		t.Errorf("Expected stats in policy, got %v", w.Body.String())
+	}
+
+	// Act get metrics
+	w = send("GET", "/api/v1/metrics", "")
+
+	// Assert
+	for _, m := range []string{`otlpinf_policies{status="running"} 1`, `otlpinf_policy_up{policy="policy_test"} 1`, `otlpinf_policy_resident_memory_bytes{policy="policy_test"}`} {
+		if !strings.Contains(w.Body.String(), m) {
+			t.Errorf("Expected metric %v, got %v", m, w.Body.String())
+		}
+	}
+
+	// Act get stats of paused policy
+	send("POST", policyAPI+"/pause", "")
+	w = send("GET", policyAPI+"/stats", "")
+
+	// Assert
+	if w.Code != http.StatusConflict {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusConflict)
+	}
+}
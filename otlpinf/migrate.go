@@ -0,0 +1,67 @@
+package otlpinf
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+)
+
+// Migration is the result of moving policies to a collector. It stops at the first policy that
+// fails to start on the collector, which keeps running on its previous one, leaving the
+// policies after it pending.
+type Migration struct {
+	Message  string   `json:"message,omitempty"`
+	Migrated []string `json:"migrated"`
+	Skipped  []string `json:"skipped"`
+	Failed   string   `json:"failed,omitempty"`
+	Pending  []string `json:"pending"`
+}
+
+// migrateCollector moves the policies matching the selector and status query parameters to the
+// collector one after the other, each being running on it before the next one is restarted.
+// Policies running their own binary are skipped, and paused policies are paused again once
+// they started on the collector.
+func (o *OltpInf) migrateCollector(c *gin.Context) {
+	name := c.Param("collector")
+	if _, ok := o.getCollector(name); !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"collector not found"})
+		return
+	}
+	selected := name
+	if name == defaultCollector {
+		selected = ""
+	}
+	o.writeMutex.Lock()
+	defer o.writeMutex.Unlock()
+	matched, ok := o.matchPolicies(c)
+	if !ok {
+		return
+	}
+	m := Migration{Migrated: make([]string, 0), Skipped: make([]string, 0), Pending: make([]string, 0)}
+	for i, p := range matched {
+		rInfo, ok := o.getRunnerInfo(p.Name)
+		if !ok || rInfo.Policy.Binary != "" || rInfo.Policy.Collector == selected {
+			m.Skipped = append(m.Skipped, p.Name)
+			continue
+		}
+		data := rInfo.Policy
+		data.Collector = selected
+		paused := rInfo.Instance.GetStatus().Status == runner.Paused
+		rInfo, err := o.swapRunner(p.Name, rInfo, data, requestAuthor(c), "migrated to collector "+name)
+		if err != nil {
+			m.Message = "policy " + p.Name + " failed to start on collector " + name + ": " + err.Error()
+			m.Failed = p.Name
+			for _, pending := range matched[i+1:] {
+				m.Pending = append(m.Pending, pending.Name)
+			}
+			c.IndentedJSON(http.StatusBadRequest, m)
+			return
+		}
+		if paused {
+			rInfo.Instance.Pause(o.ctx)
+		}
+		m.Migrated = append(m.Migrated, p.Name)
+	}
+	c.IndentedJSON(http.StatusOK, m)
+}
@@ -2,19 +2,57 @@ package otlpinf
 
 import (
 	"context"
+	"crypto"
+	"fmt"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/events"
 	"github.com/leoparente/opentelemetry-infinity/runner"
+	"github.com/leoparente/opentelemetry-infinity/secrets"
+	"github.com/leoparente/opentelemetry-infinity/webhook"
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v3"
 )
 
+// Runner is the collector of a policy, implemented by runner.Runner.
+type Runner interface {
+	Configure(c *config.Policy) error
+	Start(ctx context.Context, cancelFunc context.CancelFunc) error
+	Stop(ctx context.Context)
+	Pause(ctx context.Context)
+	Restart(ctx context.Context, cancelFunc context.CancelFunc) error
+	GetStatus() runner.State
+	Logs() []string
+	Stats() (runner.ProcessStats, error)
+}
+
+// RunnerSettings are the settings otlpinf resolves for the runner of a policy, which is then
+// configured with the policy.
+type RunnerSettings struct {
+	// Binary is the collector binary, empty for the embedded otelcol-contrib
+	Binary         string
+	StartupTimeout time.Duration
+	// CgroupDir is the cgroup the collectors with memory or CPU limits are placed in
+	CgroupDir string
+	Secrets   *secrets.Store
+	Events    *events.Bus
+}
+
+// RunnerFactory creates the runner of a policy with the settings otlpinf resolved for it.
+type RunnerFactory func(policy string, settings RunnerSettings) Runner
+
 type RunnerInfo struct {
-	Policy   config.Policy
-	Instance runner.Runner
+	Policy     config.Policy
+	Instance   Runner
+	Revisions  []Revision
+	Generation int64
+	// Version is the ETag of the policy, taken from a counter shared by all the policies so that a
+	// deleted and created again policy never matches the ETags of the previous one
+	Version int64
 }
 
 type OltpInf struct {
@@ -22,15 +60,63 @@ type OltpInf struct {
 	conf           *config.Config
 	stat           config.Status
 	policies       map[string]RunnerInfo
+	policiesMutex  *sync.RWMutex
+	writeMutex     *sync.Mutex
+	templates      map[string]config.Template
+	templatesMutex *sync.RWMutex
+	fragments      map[string]config.Fragment
+	fragmentsMutex *sync.RWMutex
 	policiesDir    string
 	ctx            context.Context
 	cancelFunction context.CancelFunc
 	router         *gin.Engine
-	capabilities   []byte
+	// capabilities caches the components output of the registered collector binaries, "" being the embedded one
+	capabilities      map[string][]byte
+	capabilitiesMutex *sync.Mutex
+	collectors        map[string]Collector
+	collectorsMutex   *sync.RWMutex
+	uploadDir         string
+	removeUploadDir   bool
+	publicKey         crypto.PublicKey
+	logLevel          zap.AtomicLevel
+	secrets           *secrets.Store
+	events            *events.Bus
+	runnerFactory     RunnerFactory
+	// version is the last version given to a policy
+	version *atomic.Int64
+	// taps are the tapped policies, changed while holding writeMutex
+	taps map[string]*tap
+}
+
+type Option func(*OltpInf)
+
+// WithLogLevel sets the level of the otlpinf logger so it can be changed through the REST API.
+func WithLogLevel(level zap.AtomicLevel) Option {
+	return func(o *OltpInf) {
+		o.logLevel = level
+	}
+}
+
+// WithRunnerFactory creates the policy runners with factory instead of running a collector
+// process for each of them.
+func WithRunnerFactory(factory RunnerFactory) Option {
+	return func(o *OltpInf) {
+		o.runnerFactory = factory
+	}
 }
 
-func New(logger *zap.Logger, c *config.Config) (OltpInf, error) {
-	return OltpInf{logger: logger, conf: c, policies: make(map[string]RunnerInfo)}, nil
+func New(logger *zap.Logger, c *config.Config, opts ...Option) (OltpInf, error) {
+	o := OltpInf{logger: logger, conf: c, policies: make(map[string]RunnerInfo),
+		policiesMutex: &sync.RWMutex{}, writeMutex: &sync.Mutex{},
+		capabilities: make(map[string][]byte), capabilitiesMutex: &sync.Mutex{},
+		collectors: make(map[string]Collector), collectorsMutex: &sync.RWMutex{},
+		taps: make(map[string]*tap), templates: make(map[string]config.Template), templatesMutex: &sync.RWMutex{},
+		fragments: make(map[string]config.Fragment), fragmentsMutex: &sync.RWMutex{}, version: &atomic.Int64{}, logLevel: zap.NewAtomicLevel(),
+		secrets: secrets.New(c.Secrets.Dir, c.Secrets.EnvPrefix), events: events.NewBus()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o, nil
 }
 
 func (o *OltpInf) Start(ctx context.Context, cancelFunc context.CancelFunc) error {
@@ -38,33 +124,103 @@ func (o *OltpInf) Start(ctx context.Context, cancelFunc context.CancelFunc) erro
 	o.ctx = context.WithValue(ctx, "routine", "otlpInfRoutine")
 	o.cancelFunction = cancelFunc
 
+	if l := o.conf.PolicyDefaults.Limits; o.conf.Cgroup.Dir == "" && (l.MemoryMB > 0 || l.CPU > 0) {
+		return fmt.Errorf("policy_defaults: %w", errLimitsWithoutCgroup)
+	}
 	var err error
 	o.policiesDir, err = os.MkdirTemp("", "policies")
 	if err != nil {
 		return err
 	}
-	o.capabilities, err = runner.GetCapabilities()
-	if err != nil {
+	if err = o.startCollectors(); err != nil {
 		return err
 	}
-	s := struct {
-		Buildinfo struct {
-			Version string
-		}
-	}{}
-	err = yaml.Unmarshal(o.capabilities, &s)
-	if err != nil {
+	if err = o.startCollectorUpload(); err != nil {
 		return err
 	}
-	o.stat.Version = s.Buildinfo.Version
 
-	o.startServer()
-
-	return nil
+	if err = o.startWebhooks(); err != nil {
+		return err
+	}
+	return o.startServer()
 }
 
 func (o *OltpInf) Stop(ctx context.Context) {
 	o.logger.Info("routine call for stop otlpinf", zap.Any("routine", ctx.Value("routine")))
 	defer os.RemoveAll(o.policiesDir)
+	if o.removeUploadDir {
+		defer os.RemoveAll(o.uploadDir)
+	}
+	if o.conf.Server.Socket != "" {
+		defer os.Remove(o.conf.Server.Socket)
+	}
 	o.cancelFunction()
 }
+
+// binaryCapabilities returns the components of a collector binary, running its components
+// command only the first time. The command runs without holding the lock, so that a slow binary
+// does not hold up the lookups of the others.
+func (o *OltpInf) binaryCapabilities(binary string) ([]byte, error) {
+	o.capabilitiesMutex.Lock()
+	capabilities, ok := o.capabilities[binary]
+	o.capabilitiesMutex.Unlock()
+	if ok {
+		return capabilities, nil
+	}
+	capabilities, err := runner.GetCapabilities(binary)
+	if err != nil {
+		return nil, err
+	}
+	o.capabilitiesMutex.Lock()
+	defer o.capabilitiesMutex.Unlock()
+	o.capabilities[binary] = capabilities
+	return capabilities, nil
+}
+
+func (o *OltpInf) getRunnerInfo(policy string) (RunnerInfo, bool) {
+	o.policiesMutex.RLock()
+	defer o.policiesMutex.RUnlock()
+	rInfo, ok := o.policies[policy]
+	return rInfo, ok
+}
+
+func (o *OltpInf) setRunnerInfo(policy string, rInfo RunnerInfo) {
+	o.policiesMutex.Lock()
+	defer o.policiesMutex.Unlock()
+	o.policies[policy] = rInfo
+}
+
+func (o *OltpInf) removeRunnerInfo(policy string) {
+	o.policiesMutex.Lock()
+	defer o.policiesMutex.Unlock()
+	delete(o.policies, policy)
+}
+
+// startWebhooks notifies the configured webhooks of the policy events, resolving the secret
+// references in their secrets and headers.
+func (o *OltpInf) startWebhooks() error {
+	if len(o.conf.Webhooks) == 0 {
+		return nil
+	}
+	webhooks := make([]config.WebhookConfig, len(o.conf.Webhooks))
+	for i, w := range o.conf.Webhooks {
+		var err error
+		if w.Secret, err = o.secrets.ResolveString(w.Secret); err != nil {
+			return err
+		}
+		headers := make(map[string]string, len(w.Headers))
+		for k, v := range w.Headers {
+			if headers[k], err = o.secrets.ResolveString(v); err != nil {
+				return err
+			}
+		}
+		w.Headers = headers
+		webhooks[i] = w
+	}
+	n, err := webhook.New(o.logger, webhooks, o.conf.CrashLoop)
+	if err != nil {
+		return err
+	}
+	n.Start(o.ctx, o.events)
+	return nil
+}
@@ -11,7 +11,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/leoparente/opentelemetry-infinity/config"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest"
 	"gopkg.in/yaml.v2"
 )
@@ -19,6 +21,7 @@ import (
 const (
 	TEST_HOST         = "localhost"
 	POLICIES_API      = "/api/v1/policies"
+	LOGLEVEL_API      = "/api/v1/loglevel"
 	HTTP_YAML_CONTENT = "application/x-yaml"
 	ERROR_MSG         = "HTTP status code = %v, wanted %v"
 	NEW_ERR_MSG       = "New() error = %v"
@@ -30,9 +33,11 @@ func TestOtlpInfRestApis(t *testing.T) {
 	// Arrange
 	logger := zaptest.NewLogger(t)
 	cfg := config.Config{
-		Debug:      true,
-		ServerHost: TEST_HOST,
-		ServerPort: 55680,
+		Debug: true,
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55680,
+		},
 	}
 
 	otlp, err := New(logger, &cfg)
@@ -62,6 +67,16 @@ func TestOtlpInfRestApis(t *testing.T) {
 		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
 	}
 
+	// Act get capabilities of a binary that is not a registered collector
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/capabilities?collector=/usr/bin/yes", nil)
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusNotFound {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusNotFound)
+	}
+
 	// Act
 	w = httptest.NewRecorder()
 	req, _ = http.NewRequest("GET", POLICIES_API, nil)
@@ -82,6 +97,16 @@ func TestOtlpInfRestApis(t *testing.T) {
 		t.Errorf(ERROR_MSG, w.Code, http.StatusNotFound)
 	}
 
+	// Act get logs of invalid policy
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/policies/invalid_policy/logs", nil)
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusNotFound {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusNotFound)
+	}
+
 	// Act delete invalid policy
 	w = httptest.NewRecorder()
 	req, _ = http.NewRequest("DELETE", "/api/v1/policies/invalid_policy", nil)
@@ -114,16 +139,269 @@ func TestOtlpInfRestApis(t *testing.T) {
 	}
 }
 
+func TestOtlpInfAuthentication(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		Debug: true,
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55685,
+		},
+		Auth: config.AuthConfig{
+			Token: "secret",
+		},
+	}
+
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+
+	otlp.setupRouter()
+
+	// Act without token
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/status", nil)
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusUnauthorized)
+	}
+
+	// Act with wrong token
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/status", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusUnauthorized)
+	}
+
+	// Act with valid token
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/status", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+}
+
+func TestOtlpInfLogLevel(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55687,
+		},
+	}
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+
+	otlp, err := New(logger, &cfg, WithLogLevel(level))
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+
+	otlp.setupRouter()
+
+	// Act
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", LOGLEVEL_API, nil)
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), `"info"`) {
+		t.Errorf("Expected level info, but got: %s", w.Body.String())
+	}
+
+	// Act change level
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", LOGLEVEL_API, bytes.NewBuffer([]byte(`{"level": "debug"}`)))
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	if level.Level() != zap.DebugLevel {
+		t.Errorf("Expected level to be debug, but got %v", level.Level())
+	}
+
+	// Act invalid level
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", LOGLEVEL_API, bytes.NewBuffer([]byte(`{"level": "verbose"}`)))
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+	if level.Level() != zap.DebugLevel {
+		t.Errorf("Expected level to remain debug, but got %v", level.Level())
+	}
+}
+
+func TestOtlpInfRequestBodyLimit(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55686,
+		},
+		Limits: config.LimitsConfig{
+			MaxRequestBodyBytes: 8,
+		},
+	}
+
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+
+	otlp.setupRouter()
+
+	// Act
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", POLICIES_API, bytes.NewBuffer([]byte("policy_test:\n  config: {}\n")))
+	req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+	if !strings.Contains(w.Body.String(), "request body too large") {
+		t.Errorf("Expected a 'request body too large' error, but got: %s", w.Body.String())
+	}
+}
+
+func TestOtlpInfApplyDefaults(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		PolicyDefaults: config.PolicyDefaults{
+			FeatureGates: []string{"default_gate"},
+			Set: map[string]string{
+				"processors.batch.timeout":  "1s",
+				"exporters.debug.verbosity": "basic",
+			},
+		},
+	}
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	policy := config.Policy{
+		FeatureGates: []string{"policy_gate"},
+		Set: map[string]string{
+			"processors.batch.timeout": "2s",
+		},
+	}
+
+	// Act
+	applied := otlp.applyDefaults(policy)
+
+	// Assert
+	if strings.Join(applied.FeatureGates, ",") != "default_gate,policy_gate" {
+		t.Errorf("Expected feature gates to be default_gate,policy_gate, got %v", applied.FeatureGates)
+	}
+	if applied.Set["processors.batch.timeout"] != "2s" || applied.Set["exporters.debug.verbosity"] != "basic" {
+		t.Errorf("Expected policy sets to override defaults, got %v", applied.Set)
+	}
+	if len(policy.Set) != 1 {
+		t.Errorf("Expected original policy to be unchanged, got %v", policy.Set)
+	}
+}
+
+func TestOtlpinfApplyDefaultLimits(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	nice := 5
+	cfg := config.Config{
+		PolicyDefaults: config.PolicyDefaults{
+			Limits: config.ResourceLimits{MemoryMB: 512, OpenFiles: 1024, Nice: &nice},
+		},
+	}
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	policy := config.Policy{Limits: &config.ResourceLimits{MemoryMB: 256, CPU: 0.5}}
+
+	// Act
+	applied := otlp.applyDefaults(policy)
+	unlimited := otlp.applyDefaults(config.Policy{})
+
+	// Assert
+	l := applied.Limits
+	if l.MemoryMB != 256 || l.CPU != 0.5 || l.OpenFiles != 1024 || l.Nice == nil || *l.Nice != 5 {
+		t.Errorf("Expected policy limits to override defaults, got %+v", *l)
+	}
+	if policy.Limits.OpenFiles != 0 {
+		t.Errorf("Expected original policy limits to be unchanged, got %+v", *policy.Limits)
+	}
+	if unlimited.Limits == nil || unlimited.Limits.MemoryMB != 512 {
+		t.Errorf("Expected default limits for a policy without limits, got %v", unlimited.Limits)
+	}
+}
+
+func TestOtlpinfLimitsWithoutCgroup(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		PolicyDefaults: config.PolicyDefaults{Limits: config.ResourceLimits{CPU: 1}},
+	}
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	err = otlp.Start(ctx, cancel)
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "cgroup.dir") {
+		t.Errorf("Expected a cgroup.dir error, but got %v", err)
+	}
+
+	// Act policy limits
+	cfg.PolicyDefaults.Limits = config.ResourceLimits{OpenFiles: 1024}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	withoutCgroup := otlp.checkLimits(c, config.Policy{Limits: &config.ResourceLimits{MemoryMB: 256}})
+	cfg.Cgroup.Dir = t.TempDir()
+	withCgroup := otlp.checkLimits(c, config.Policy{Limits: &config.ResourceLimits{MemoryMB: 256}})
+
+	// Assert
+	if withoutCgroup || !withCgroup {
+		t.Errorf("Expected memory limits to be refused only without cgroup, got %v and %v", withoutCgroup, withCgroup)
+	}
+}
+
 func TestOtlpinfCreateDeletePolicy(t *testing.T) {
 	// Arrange
 	logger := zaptest.NewLogger(t)
 	cfg := config.Config{
-		Debug:      true,
-		ServerHost: TEST_HOST,
-		ServerPort: 55681,
+		Debug: true,
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55681,
+		},
 	}
 
-	SERVER := fmt.Sprintf("http://%s:%v", cfg.ServerHost, cfg.ServerPort)
+	SERVER := fmt.Sprintf("http://%s:%v", cfg.Server.Host, cfg.Server.Port)
 
 	// Act and Assert
 	otlp, err := New(logger, &cfg)
@@ -206,6 +484,17 @@ func TestOtlpinfCreateDeletePolicy(t *testing.T) {
 		t.Errorf(ERROR_MSG, resp.StatusCode, http.StatusOK)
 	}
 
+	// Act Get Policy Logs
+	resp, err = http.Get(SERVER + "/api/v1/policies/" + policyName + "/logs?tail=1")
+	if err != nil {
+		t.Errorf("http.Get() error = %v", err)
+	}
+
+	// Assert
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf(ERROR_MSG, resp.StatusCode, http.StatusOK)
+	}
+
 	// Act Try to insert same policy
 	err = yaml.NewEncoder(&buf).Encode(data)
 	if err != nil {
@@ -244,12 +533,14 @@ func TestOtlpinfCreateInvalidPolicy(t *testing.T) {
 	// Arrange
 	logger := zaptest.NewLogger(t)
 	cfg := config.Config{
-		Debug:      true,
-		ServerHost: TEST_HOST,
-		ServerPort: 55682,
+		Debug: true,
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55682,
+		},
 	}
 
-	SERVER := fmt.Sprintf("http://%s:%v", cfg.ServerHost, cfg.ServerPort)
+	SERVER := fmt.Sprintf("http://%s:%v", cfg.Server.Host, cfg.Server.Port)
 
 	// Act and Assert
 	otlp, err := New(logger, &cfg)
@@ -290,6 +581,43 @@ func TestOtlpinfCreateInvalidPolicy(t *testing.T) {
 		t.Errorf(ERROR_MSG, resp.StatusCode, http.StatusForbidden)
 	}
 
+	//Act try to insert policy named as a parent directory
+	err = yaml.NewEncoder(&buf).Encode(map[string]interface{}{
+		"..": map[string]interface{}{"config": map[string]interface{}{"receivers": nil}},
+	})
+	if err != nil {
+		t.Errorf(YAML_ERR_MSG, err)
+	}
+
+	resp, err = http.Post(SERVER+POLICIES_API, HTTP_YAML_CONTENT, &buf)
+	if err != nil {
+		t.Errorf(POST_ERR_MSG, err)
+	}
+
+	// Assert
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, resp.StatusCode, http.StatusBadRequest)
+	}
+
+	//Act try to insert policy with a remote config source
+	data[policyName] = map[string]interface{}{
+		"sources": []string{"https://config.example.com/config.yaml"},
+	}
+	err = yaml.NewEncoder(&buf).Encode(data)
+	if err != nil {
+		t.Errorf(YAML_ERR_MSG, err)
+	}
+
+	resp, err = http.Post(SERVER+POLICIES_API, HTTP_YAML_CONTENT, &buf)
+	if err != nil {
+		t.Errorf(POST_ERR_MSG, err)
+	}
+
+	// Assert
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, resp.StatusCode, http.StatusBadRequest)
+	}
+
 	//Act try to insert policy with invalid config
 	data[policyName] = map[string]interface{}{
 		"config": map[string]interface{}{
@@ -344,9 +672,11 @@ func TestOtlpinfStartError(t *testing.T) {
 	// Arrange
 	logger := zaptest.NewLogger(t)
 	cfg := config.Config{
-		Debug:      true,
-		ServerHost: TEST_HOST,
-		ServerPort: 55684,
+		Debug: true,
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55684,
+		},
 	}
 
 	// Change the temporary directory environment variable to an invalid path
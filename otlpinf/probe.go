@@ -0,0 +1,247 @@
+package otlpinf
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+	"golang.org/x/net/http2"
+)
+
+// probeTimeout is how long a receiver has to accept a synthetic request.
+const probeTimeout = 5 * time.Second
+
+// grpcServices are the OTLP gRPC export methods of each signal.
+var grpcServices = map[string]string{
+	signalTraces:  "/opentelemetry.proto.collector.trace.v1.TraceService/Export",
+	signalMetrics: "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export",
+	signalLogs:    "/opentelemetry.proto.collector.logs.v1.LogsService/Export",
+}
+
+// Probe is the result of sending synthetic telemetry to the OTLP receivers of a policy.
+type Probe struct {
+	// Accepted is true when every receiver accepted every request
+	Accepted bool          `json:"accepted"`
+	Results  []ProbeResult `json:"results"`
+}
+
+// ProbeResult is how an OTLP receiver answered the synthetic request of a signal.
+type ProbeResult struct {
+	Receiver  string  `json:"receiver"`
+	Protocol  string  `json:"protocol"`
+	Endpoint  string  `json:"endpoint"`
+	Signal    string  `json:"signal"`
+	Accepted  bool    `json:"accepted"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// probeTarget is an OTLP receiver protocol and the signals its pipelines carry.
+type probeTarget struct {
+	receiver string
+	protocol string
+	endpoint string
+	// paths are the HTTP paths of the signals
+	paths   map[string]string
+	tls     bool
+	signals []string
+}
+
+// probePolicy sends a synthetic span, metric and log record to the OTLP receivers of a running
+// policy, for the signals of the pipelines they are in, and replies with whether they were accepted.
+func (o *OltpInf) probePolicy(c *gin.Context) {
+	policy := c.Param("policy")
+	rInfo, ok := o.getRunnerInfo(policy)
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return
+	}
+	if rInfo.Instance.GetStatus().Status != runner.Running {
+		c.IndentedJSON(http.StatusConflict, ReturnValue{"policy is not running"})
+		return
+	}
+	rendered, err := o.inspectedPolicy(rInfo.Policy)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, ReturnValue{err.Error()})
+		return
+	}
+	targets := probeTargets(rendered)
+	if len(targets) == 0 {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"policy has no otlp receiver in its pipelines"})
+		return
+	}
+
+	probe := Probe{Accepted: true, Results: make([]ProbeResult, 0)}
+	for _, t := range targets {
+		for _, signal := range t.signals {
+			result := ProbeResult{Receiver: t.receiver, Protocol: t.protocol, Endpoint: t.endpoint, Signal: signal}
+			start := time.Now()
+			err := t.send(c.Request.Context(), signal, syntheticRequest(signal, policy, start))
+			result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+			if err != nil {
+				result.Error = err.Error()
+				probe.Accepted = false
+			} else {
+				result.Accepted = true
+			}
+			probe.Results = append(probe.Results, result)
+		}
+	}
+	c.IndentedJSON(http.StatusOK, probe)
+}
+
+// probeTargets returns the protocols of the OTLP receivers used by the pipelines of a policy,
+// sorted by receiver and protocol.
+func probeTargets(p config.Policy) []probeTarget {
+	receivers, _ := p.Config["receivers"].(map[string]interface{})
+	service, _ := p.Config["service"].(map[string]interface{})
+	pipelines, _ := service["pipelines"].(map[string]interface{})
+	signals := make(map[string]map[string]bool)
+	for id, pipeline := range pipelines {
+		signal := componentType(id)
+		if _, ok := grpcServices[signal]; !ok {
+			continue
+		}
+		settings, _ := pipeline.(map[string]interface{})
+		ids, _ := settings["receivers"].([]interface{})
+		for _, r := range ids {
+			name, _ := r.(string)
+			if _, ok := receivers[name]; !ok || componentType(name) != "otlp" {
+				continue
+			}
+			if signals[name] == nil {
+				signals[name] = make(map[string]bool)
+			}
+			signals[name][signal] = true
+		}
+	}
+
+	targets := make([]probeTarget, 0)
+	for name, used := range signals {
+		s, _ := receivers[name].(map[string]interface{})
+		protocols, _ := s["protocols"].(map[string]interface{})
+		for protocol, defaultPort := range map[string]string{"grpc": "4317", "http": "4318"} {
+			settings, ok := protocols[protocol]
+			if !ok {
+				continue
+			}
+			ps, _ := settings.(map[string]interface{})
+			t := probeTarget{receiver: name, protocol: protocol, endpoint: localEndpoint(ps["endpoint"], defaultPort),
+				tls: ps["tls"] != nil, paths: make(map[string]string)}
+			for signal := range used {
+				t.signals = append(t.signals, signal)
+				t.paths[signal] = "/v1/" + signal
+				if path, ok := ps[signal+"_url_path"].(string); ok && path != "" {
+					t.paths[signal] = "/" + strings.TrimPrefix(path, "/")
+				}
+			}
+			sort.Strings(t.signals)
+			targets = append(targets, t)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].receiver != targets[j].receiver {
+			return targets[i].receiver < targets[j].receiver
+		}
+		return targets[i].protocol < targets[j].protocol
+	})
+	return targets
+}
+
+// localEndpoint returns the address a local client connects to for a receiver endpoint, the
+// unspecified address being reached through localhost.
+func localEndpoint(endpoint interface{}, defaultPort string) string {
+	e, _ := endpoint.(string)
+	host, port, err := net.SplitHostPort(e)
+	if err != nil || port == "" {
+		return net.JoinHostPort("localhost", defaultPort)
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// send exports a synthetic request of the signal to the receiver, returning an error unless it
+// is accepted.
+func (t probeTarget) send(ctx context.Context, signal string, payload []byte) error {
+	if t.tls {
+		return errors.New("receivers with tls are not probed")
+	}
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	if t.protocol == "grpc" {
+		return sendGRPC(ctx, t.endpoint, grpcServices[signal], payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+t.endpoint+t.paths[signal], bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("receiver replied %s", resp.Status)
+	}
+	return nil
+}
+
+// sendGRPC calls a unary gRPC method over plaintext HTTP/2, as OTLP receivers without tls serve it.
+func sendGRPC(ctx context.Context, endpoint string, method string, payload []byte) error {
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	defer transport.CloseIdleConnections()
+	// a gRPC message is prefixed with its compression flag and length
+	body := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(payload)))
+	body = append(body, payload...)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+endpoint+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// the status is sent in the trailers, which are only read with the body
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("receiver replied %s", resp.Status)
+	}
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// a response without a message carries its status in the headers
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if status == "" {
+		return errors.New("receiver replied without a grpc status")
+	}
+	if status != "0" {
+		return fmt.Errorf("receiver replied grpc status %s: %s", status, message)
+	}
+	return nil
+}
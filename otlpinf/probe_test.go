@@ -0,0 +1,174 @@
+package otlpinf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"go.uber.org/zap/zaptest"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const TEST_PROBE_POLICY = `policy_probe:
+  config:
+    receivers:
+      otlp:
+        protocols:
+          grpc:
+            endpoint: %s
+          http:
+            endpoint: %s
+            logs_url_path: /custom/logs
+      otlp/closed:
+        protocols:
+          http:
+            endpoint: %s
+    exporters:
+      debug:
+    service:
+      pipelines:
+        traces:
+          receivers: [otlp]
+          exporters: [debug]
+        logs:
+          receivers: [otlp]
+          exporters: [debug]
+        metrics:
+          receivers: [otlp/closed]
+          exporters: [debug]
+`
+
+// isExportRequest tells if b is an OTLP export request holding a resource.
+func isExportRequest(b []byte) bool {
+	num, typ, n := protowire.ConsumeTag(b)
+	if n < 0 || num != 1 || typ != protowire.BytesType {
+		return false
+	}
+	resource, m := protowire.ConsumeBytes(b[n:])
+	return m > 0 && len(resource) > 0
+}
+
+func TestOtlpInfProbePolicy(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	var mutex sync.Mutex
+	received := make(map[string]bool)
+	httpReceiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "application/x-protobuf" || !isExportRequest(body) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mutex.Lock()
+		received["http "+r.URL.Path] = true
+		mutex.Unlock()
+	}))
+	defer httpReceiver.Close()
+	grpcReceiver := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		status := "0"
+		if r.ProtoMajor != 2 || len(body) < 5 || !isExportRequest(body[5:]) {
+			status = "3"
+		}
+		mutex.Lock()
+		received["grpc "+r.URL.Path] = true
+		mutex.Unlock()
+		w.WriteHeader(http.StatusOK)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", status)
+	}), &http2.Server{}))
+	defer grpcReceiver.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55699,
+		},
+		CollectorBinary: writeTestCollector(t),
+	}
+	otlp, err := New(logger, &cfg, WithRunnerFactory(newFakeRunners().factory))
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		otlp.router.ServeHTTP(w, req)
+		return w
+	}
+	policy := fmt.Sprintf(TEST_PROBE_POLICY, grpcReceiver.Listener.Addr(), httpReceiver.Listener.Addr(), closed)
+	if w := send("POST", POLICIES_API, policy); w.Code != http.StatusCreated {
+		t.Fatalf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+
+	// Act probe missing policy
+	w := send("POST", POLICIES_API+"/missing/probe", "")
+
+	// Assert
+	if w.Code != http.StatusNotFound {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusNotFound)
+	}
+
+	// Act probe policy
+	w = send("POST", POLICIES_API+"/policy_probe/probe", "")
+	var probe Probe
+	err = json.Unmarshal(w.Body.Bytes(), &probe)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	if err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if probe.Accepted || len(probe.Results) != 5 {
+		t.Fatalf("Expected 5 results with a refused receiver, got %+v", probe)
+	}
+	for i, expected := range []string{"otlp grpc logs", "otlp grpc traces", "otlp http logs", "otlp http traces", "otlp/closed http metrics"} {
+		r := probe.Results[i]
+		if got := r.Receiver + " " + r.Protocol + " " + r.Signal; got != expected {
+			t.Errorf("Expected result %d to be %s, got %s", i, expected, got)
+		}
+		if r.Accepted != (r.Receiver == "otlp") || r.Accepted != (r.Error == "") {
+			t.Errorf("Expected only the otlp receiver to accept the requests, got %+v", r)
+		}
+	}
+	for _, path := range []string{"http /v1/traces", "http /custom/logs", "grpc /opentelemetry.proto.collector.trace.v1.TraceService/Export",
+		"grpc /opentelemetry.proto.collector.logs.v1.LogsService/Export"} {
+		if !received[path] {
+			t.Errorf("Expected the receivers to get %s", path)
+		}
+	}
+
+	// Act probe paused policy
+	send("POST", POLICIES_API+"/policy_probe/pause", "")
+	w = send("POST", POLICIES_API+"/policy_probe/probe", "")
+
+	// Assert
+	if w.Code != http.StatusConflict {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusConflict)
+	}
+}
@@ -0,0 +1,148 @@
+package otlpinf
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/events"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+)
+
+// PolicySummary is the short form of a policy returned by policy queries.
+type PolicySummary struct {
+	Name         string            `json:"name"`
+	Status       string            `json:"status"`
+	Generation   int64             `json:"generation"`
+	Description  string            `json:"description,omitempty"`
+	Owner        string            `json:"owner,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	RestartCount int64             `json:"restart_count"`
+	LastError    string            `json:"last_error,omitempty"`
+}
+
+// PolicyPage is a page of the policies matching a query. Continue is the token to request the
+// next page, and Summary counts every matching policy by status.
+type PolicyPage struct {
+	Items    []PolicySummary  `json:"items"`
+	Total    int              `json:"total"`
+	Summary  map[string]int64 `json:"summary"`
+	Continue string           `json:"continue,omitempty"`
+}
+
+var listQueryParams = []string{"selector", "status", "limit", "continue"}
+
+// hasListQuery reports whether the policies request is a query, which is answered with a page
+// instead of the plain list of names.
+func hasListQuery(c *gin.Context) bool {
+	for _, p := range listQueryParams {
+		if _, ok := c.GetQuery(p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPolicies returns the sorted summaries of the policies matching the selector and status
+// query parameters, replying with the error if they are invalid.
+func (o *OltpInf) matchPolicies(c *gin.Context) ([]PolicySummary, bool) {
+	sel, err := parseSelector(c.Query("selector"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+		return nil, false
+	}
+	statuses := make(map[string]bool)
+	if status := c.Query("status"); status != "" {
+		known := make(map[string]bool, len(runner.MapStatus))
+		for _, s := range runner.MapStatus {
+			known[s] = true
+		}
+		for _, s := range strings.Split(status, ",") {
+			if !known[s] {
+				c.IndentedJSON(http.StatusBadRequest, ReturnValue{"invalid status " + s})
+				return nil, false
+			}
+			statuses[s] = true
+		}
+	}
+	o.policiesMutex.RLock()
+	defer o.policiesMutex.RUnlock()
+	matched := make([]PolicySummary, 0)
+	for name, rInfo := range o.policies {
+		if !sel.Matches(rInfo.Policy.Labels) {
+			continue
+		}
+		state := rInfo.Instance.GetStatus()
+		if len(statuses) > 0 && !statuses[state.StatusText] {
+			continue
+		}
+		matched = append(matched, PolicySummary{
+			Name:         name,
+			Status:       state.StatusText,
+			Generation:   rInfo.Generation,
+			Description:  rInfo.Policy.Description,
+			Owner:        rInfo.Policy.Owner,
+			Labels:       rInfo.Policy.Labels,
+			RestartCount: state.RestartCount,
+			LastError:    state.LastError,
+		})
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Name < matched[j].Name })
+	return matched, true
+}
+
+func (o *OltpInf) listPolicies(c *gin.Context) {
+	limit := 0
+	if l := c.Query("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			c.IndentedJSON(http.StatusBadRequest, ReturnValue{"invalid limit " + l})
+			return
+		}
+	}
+	matched, ok := o.matchPolicies(c)
+	if !ok {
+		return
+	}
+	page := PolicyPage{Total: len(matched), Summary: make(map[string]int64)}
+	for _, p := range matched {
+		page.Summary[p.Status]++
+	}
+	// continue holds the name of the last policy returned, so pages stay consistent when
+	// policies are created or deleted between requests
+	if after := c.Query("continue"); after != "" {
+		matched = matched[sort.Search(len(matched), func(i int) bool { return matched[i].Name > after }):]
+	}
+	if limit > 0 && len(matched) > limit {
+		matched = matched[:limit]
+		page.Continue = matched[limit-1].Name
+	}
+	page.Items = matched
+	c.IndentedJSON(http.StatusOK, page)
+}
+
+// deletePolicies deletes every policy matching the selector and status query parameters.
+func (o *OltpInf) deletePolicies(c *gin.Context) {
+	if c.Query("selector") == "" && c.Query("status") == "" {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"selector or status query parameter is required"})
+		return
+	}
+	o.writeMutex.Lock()
+	defer o.writeMutex.Unlock()
+	matched, ok := o.matchPolicies(c)
+	if !ok {
+		return
+	}
+	deleted := make([]string, 0, len(matched))
+	for _, p := range matched {
+		if rInfo, ok := o.getRunnerInfo(p.Name); ok {
+			rInfo.Instance.Stop(o.ctx)
+			o.removeRunnerInfo(p.Name)
+			o.publishEvent(events.Deleted, p.Name, rInfo)
+			deleted = append(deleted, p.Name)
+		}
+	}
+	c.IndentedJSON(http.StatusOK, deleted)
+}
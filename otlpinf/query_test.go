@@ -0,0 +1,122 @@
+package otlpinf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"go.uber.org/zap/zaptest"
+)
+
+const TEST_LABELED_POLICY = `%s:
+  owner: payments-oncall
+  labels:
+    team: %s
+    env: %s
+  config:
+    receivers:
+      otlp:
+        protocols:
+          http:
+    exporters:
+      debug:
+    service:
+      pipelines:
+        metrics:
+          receivers: [otlp]
+          exporters: [debug]
+`
+
+func TestOtlpInfPolicyQueries(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55691,
+		},
+	}
+
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		otlp.router.ServeHTTP(w, req)
+		return w
+	}
+	for _, p := range [][]string{{"a", "payments", "prod"}, {"b", "payments", "dev"}, {"c", "payments", "staging"}, {"d", "search", "prod"}} {
+		policy := strings.NewReplacer("%s:", p[0]+":", "team: %s", "team: "+p[1], "env: %s", "env: "+p[2]).Replace(TEST_LABELED_POLICY)
+		if w := send("POST", POLICIES_API, policy); w.Code != http.StatusCreated {
+			t.Errorf(ERROR_MSG, w.Code, http.StatusCreated)
+		}
+	}
+
+	// Act query first page
+	w := send("GET", POLICIES_API+"?selector=team=payments,env!=dev&status=running&limit=1", "")
+
+	// Assert
+	var page PolicyPage
+	if err = json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Errorf("json.Unmarshal() error = %v", err)
+	}
+	if page.Total != 2 || page.Summary["running"] != 2 || len(page.Items) != 1 || page.Items[0].Name != "a" {
+		t.Errorf("Expected first page with policy a out of 2, got %+v", page)
+	}
+	if page.Items[0].Owner != "payments-oncall" || page.Items[0].Labels["env"] != "prod" {
+		t.Errorf("Expected policy metadata, got %+v", page.Items[0])
+	}
+
+	// Act query next page
+	w = send("GET", POLICIES_API+"?selector=team=payments,env!=dev&limit=1&continue="+page.Continue, "")
+
+	// Assert
+	page = PolicyPage{}
+	if err = json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Errorf("json.Unmarshal() error = %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].Name != "c" || page.Continue != "" {
+		t.Errorf("Expected last page with policy c, got %+v", page)
+	}
+
+	// Act query invalid status
+	w = send("GET", POLICIES_API+"?status=crashed", "")
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+
+	// Act delete without selector
+	w = send("DELETE", POLICIES_API, "")
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+
+	// Act delete by selector
+	w = send("DELETE", POLICIES_API+"?selector=team=payments", "")
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	if w = send("GET", POLICIES_API, ""); strings.TrimSpace(w.Body.String()) != "[\n    \"d\"\n]" {
+		t.Errorf("Expected only policy d to be left, got %v", w.Body.String())
+	}
+}
@@ -0,0 +1,211 @@
+package otlpinf
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/config"
+)
+
+// quotaUsage returns the global quotas used by all the policies but exclude.
+func (o *OltpInf) quotaUsage(exclude string) config.QuotaStatus {
+	q := o.conf.Quotas
+	s := config.QuotaStatus{
+		Policies:         config.QuotaUsage{Limit: q.MaxPolicies},
+		MemoryLimiterMiB: config.QuotaUsage{Limit: q.MaxMemoryLimiterMiB},
+		ListeningPorts:   config.QuotaUsage{Limit: q.MaxListeningPorts},
+	}
+	o.policiesMutex.RLock()
+	defer o.policiesMutex.RUnlock()
+	for name, rInfo := range o.policies {
+		if name == exclude {
+			continue
+		}
+		// the fragments of running policies cannot be deleted, so they always render
+		rendered, _ := o.inspectedPolicy(rInfo.Policy)
+		applied := o.applyDefaults(rendered)
+		s.Policies.Used++
+		s.MemoryLimiterMiB.Used += memoryLimiterMiB(applied)
+		s.ListeningPorts.Used += listeningPorts(applied)
+	}
+	return s
+}
+
+// checkQuotas replies with 429 if there is no room for another policy, or with 403 if the policy
+// would exceed the memory_limiter or listening ports quotas. The policy being replaced, if any,
+// does not count towards the quotas. Config sources otlpinf cannot read are refused when these
+// quotas are enabled. The fragments and sources of the policy must have been merged by checkMerge.
+func (o *OltpInf) checkQuotas(c *gin.Context, policy string, data config.Policy) bool {
+	usage := o.quotaUsage(policy)
+	if q := usage.Policies; q.Limit > 0 && q.Used+1 > q.Limit {
+		c.IndentedJSON(http.StatusTooManyRequests, ReturnValue{
+			fmt.Sprintf("policies quota exceeded, %d of %d policies in use", q.Used, q.Limit)})
+		return false
+	}
+	rendered, _ := o.inspectedPolicy(data)
+	if (usage.MemoryLimiterMiB.Limit > 0 || usage.ListeningPorts.Limit > 0) && len(rendered.Sources) > 0 {
+		c.IndentedJSON(http.StatusForbidden, ReturnValue{
+			"policies with file, env or http config sources cannot be checked against the memory_limiter and listening ports quotas"})
+		return false
+	}
+	applied := o.applyDefaults(rendered)
+	if q, mib := usage.MemoryLimiterMiB, memoryLimiterMiB(applied); q.Limit > 0 && q.Used+mib > q.Limit {
+		c.IndentedJSON(http.StatusForbidden, ReturnValue{
+			fmt.Sprintf("memory_limiter quota exceeded, policy requires %d MiB and %d of %d MiB are in use", mib, q.Used, q.Limit)})
+		return false
+	}
+	if q, ports := usage.ListeningPorts, listeningPorts(applied); q.Limit > 0 && q.Used+ports > q.Limit {
+		c.IndentedJSON(http.StatusForbidden, ReturnValue{
+			fmt.Sprintf("listening ports quota exceeded, policy requires %d ports and %d of %d are in use", ports, q.Used, q.Limit)})
+		return false
+	}
+	return true
+}
+
+// componentType returns the type of a component id such as memory_limiter/name.
+func componentType(id string) string {
+	t, _, _ := strings.Cut(id, "/")
+	return t
+}
+
+// memoryLimiterMiB returns the sum of the limit_mib of the memory_limiter processors of a policy.
+func memoryLimiterMiB(p config.Policy) int64 {
+	limits := make(map[string]int64)
+	processors, _ := p.Config["processors"].(map[string]interface{})
+	for id, settings := range processors {
+		if componentType(id) == "memory_limiter" {
+			s, _ := settings.(map[string]interface{})
+			limits[id] = toInt64(s["limit_mib"])
+		}
+	}
+	// sets override the config values, as they do in the collector
+	for key, value := range p.Set {
+		id, ok := strings.CutPrefix(key, "processors.")
+		if !ok {
+			continue
+		}
+		if id, ok = strings.CutSuffix(id, ".limit_mib"); ok && componentType(id) == "memory_limiter" {
+			limits[id] = toInt64(value)
+		}
+	}
+	var total int64
+	for _, l := range limits {
+		total += l
+	}
+	return total
+}
+
+// listeners are the receivers and extensions whose endpoint or listen_address settings are
+// addresses they serve. Other components, such as the scraper receivers, connect to theirs.
+var listeners = map[string]map[string]bool{
+	"receivers": {"otlp": true, "jaeger": true, "zipkin": true, "opencensus": true, "skywalking": true, "loki": true,
+		"splunk_hec": true, "signalfx": true, "sapm": true, "carbon": true, "statsd": true, "influxdb": true,
+		"fluentforward": true, "awsxray": true, "datadog": true, "collectd": true, "webhookevent": true,
+		"tcplog": true, "udplog": true, "syslog": true},
+	"extensions": {"health_check": true, "pprof": true, "zpages": true, "remotetap": true, "jaegerremotesampling": true},
+}
+
+// listeningPorts returns the number of host:port addresses served by the receivers of the policy
+// pipelines and by the extensions of its service, counting the default port of the otlp receiver
+// protocols without an endpoint.
+func listeningPorts(p config.Policy) int64 {
+	var n int64
+	used := usedComponents(p)
+	for _, section := range []string{"receivers", "extensions"} {
+		components, _ := p.Config[section].(map[string]interface{})
+		for id, settings := range components {
+			if !used[section][id] || !listeners[section][componentType(id)] {
+				continue
+			}
+			n += countEndpoints(settings)
+			if section != "receivers" || componentType(id) != "otlp" {
+				continue
+			}
+			s, _ := settings.(map[string]interface{})
+			protocols, _ := s["protocols"].(map[string]interface{})
+			for _, protocol := range []string{"grpc", "http"} {
+				settings, ok := protocols[protocol]
+				if !ok {
+					continue
+				}
+				if s, _ := settings.(map[string]interface{}); s["endpoint"] == nil {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+// usedComponents returns the receivers of the pipelines and the extensions of the service, the
+// only ones the collector starts.
+func usedComponents(p config.Policy) map[string]map[string]bool {
+	used := map[string]map[string]bool{"receivers": {}, "extensions": {}}
+	service, _ := p.Config["service"].(map[string]interface{})
+	extensions, _ := service["extensions"].([]interface{})
+	for _, e := range extensions {
+		if id, ok := e.(string); ok {
+			used["extensions"][id] = true
+		}
+	}
+	pipelines, _ := service["pipelines"].(map[string]interface{})
+	for _, pipeline := range pipelines {
+		settings, _ := pipeline.(map[string]interface{})
+		receivers, _ := settings["receivers"].([]interface{})
+		for _, r := range receivers {
+			if id, ok := r.(string); ok {
+				used["receivers"][id] = true
+			}
+		}
+	}
+	return used
+}
+
+func countEndpoints(v interface{}) int64 {
+	var n int64
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if key != "endpoint" && key != "listen_address" {
+				n += countEndpoints(value)
+			} else if s, ok := value.(string); ok && isListenAddress(s) {
+				n++
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			n += countEndpoints(value)
+		}
+	}
+	return n
+}
+
+// isListenAddress tells host:port addresses apart from the URLs clients connect to.
+func isListenAddress(endpoint string) bool {
+	if strings.Contains(endpoint, "://") {
+		return false
+	}
+	_, port, err := net.SplitHostPort(endpoint)
+	return err == nil && port != ""
+}
+
+func toInt64(v interface{}) int64 {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case uint64:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,269 @@
+package otlpinf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"go.uber.org/zap/zaptest"
+	"gopkg.in/yaml.v3"
+)
+
+const TEST_QUOTA_POLICY = `
+receivers:
+  otlp:
+    protocols:
+      grpc:
+      http:
+        endpoint: 0.0.0.0:4320
+  otlp/unused:
+    protocols:
+      grpc:
+        endpoint: 0.0.0.0:4321
+  httpcheck:
+    targets:
+      - endpoint: http://localhost:8080/health
+  redis:
+    endpoint: localhost:6379
+  zipkin:
+    endpoint: localhost:9411
+extensions:
+  health_check:
+    endpoint: localhost:13133
+  pprof:
+    endpoint: localhost:1777
+processors:
+  memory_limiter:
+    limit_mib: 512
+  memory_limiter/tight:
+    limit_mib: "128"
+  batch:
+service:
+  extensions: [health_check]
+  pipelines:
+    traces:
+      receivers: [otlp, zipkin]
+    metrics:
+      receivers: [otlp, httpcheck, redis]
+`
+
+func TestQuotaPolicyUsage(t *testing.T) {
+	// Arrange
+	var cfg map[string]interface{}
+	if err := yaml.Unmarshal([]byte(TEST_QUOTA_POLICY), &cfg); err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+	policy := config.Policy{
+		Config: cfg,
+		Set:    map[string]string{"processors.memory_limiter/tight.limit_mib": "256"},
+	}
+
+	// Act
+	mib := memoryLimiterMiB(policy)
+	ports := listeningPorts(policy)
+
+	// Assert
+	if mib != 768 {
+		t.Errorf("Expected 768 MiB of memory_limiter, got %d", mib)
+	}
+	if ports != 4 {
+		t.Errorf("Expected 4 listening ports, got %d", ports)
+	}
+}
+
+func TestOtlpInfQuotas(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55695,
+		},
+		Quotas: config.QuotasConfig{MaxPolicies: 1, MaxListeningPorts: 1},
+	}
+
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		otlp.router.ServeHTTP(w, req)
+		return w
+	}
+	policy := strings.Replace(TEST_REVISION_POLICY, "%s", "basic", 1)
+	if w := send("POST", POLICIES_API, policy); w.Code != http.StatusCreated {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+
+	// Act update policy within quotas
+	w := send("PUT", POLICIES_API+"/policy_test", strings.Replace(policy, "basic", "detailed", 1))
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+
+	// Act update policy exceeding listening ports
+	w = send("PUT", POLICIES_API+"/policy_test", strings.Replace(policy, "http:", "http:\n          grpc:", 1))
+
+	// Assert
+	if w.Code != http.StatusForbidden {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusForbidden)
+	}
+	if !strings.Contains(w.Body.String(), "listening ports quota exceeded") {
+		t.Errorf("Expected a listening ports quota error, got %s", w.Body.String())
+	}
+
+	// Act create policy exceeding policies
+	w = send("POST", POLICIES_API, strings.Replace(policy, "policy_test", "policy_other", 1))
+
+	// Assert
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusTooManyRequests)
+	}
+
+	// Act get quotas status
+	w = send("GET", "/api/v1/status", "")
+	var status config.Status
+	err = json.Unmarshal(w.Body.Bytes(), &status)
+
+	// Assert
+	if err != nil {
+		t.Errorf("json.Unmarshal() error = %v", err)
+	}
+	if status.Quotas.Policies != (config.QuotaUsage{Used: 1, Limit: 1}) {
+		t.Errorf("Expected 1 of 1 policies, got %+v", status.Quotas.Policies)
+	}
+	if status.Quotas.ListeningPorts != (config.QuotaUsage{Used: 1, Limit: 1}) {
+		t.Errorf("Expected 1 of 1 listening ports, got %+v", status.Quotas.ListeningPorts)
+	}
+}
+
+const TEST_QUOTA_SOURCES_POLICY = `policy_sources:
+  config: {}
+  sources:
+    - receivers:
+        otlp:
+          protocols:
+            http:
+              endpoint: localhost:4318
+      processors:
+        memory_limiter:
+          limit_mib: 128
+      exporters:
+        debug:
+      service:
+        pipelines:
+          traces:
+            receivers: [otlp]
+            processors: [memory_limiter]
+            exporters: [debug]
+`
+
+func TestOtlpInfQuotaSources(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55702,
+		},
+		CollectorBinary: writeTestCollector(t),
+		Quotas:          config.QuotasConfig{MaxListeningPorts: 1, MaxMemoryLimiterMiB: 256},
+	}
+	otlp, err := New(logger, &cfg, WithRunnerFactory(newFakeRunners().factory))
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		otlp.router.ServeHTTP(w, req)
+		return w
+	}
+	tests := []struct {
+		name     string
+		policy   string
+		expected int
+		err      string
+	}{
+		{
+			name:     "inline source exceeding memory_limiter",
+			policy:   strings.Replace(TEST_QUOTA_SOURCES_POLICY, "limit_mib: 128", "limit_mib: 512", 1),
+			expected: http.StatusForbidden,
+			err:      "memory_limiter quota exceeded",
+		},
+		{
+			name: "inline source exceeding listening ports",
+			policy: strings.Replace(TEST_QUOTA_SOURCES_POLICY, "http:\n",
+				"grpc:\n              endpoint: localhost:4317\n            http:\n", 1),
+			expected: http.StatusForbidden,
+			err:      "listening ports quota exceeded",
+		},
+		{
+			name:     "yaml source exceeding memory_limiter",
+			policy:   TEST_QUOTA_SOURCES_POLICY + "    - 'yaml:processors::memory_limiter::limit_mib: 1024'\n",
+			expected: http.StatusForbidden,
+			err:      "memory_limiter quota exceeded",
+		},
+		{
+			name:     "file source",
+			policy:   TEST_QUOTA_SOURCES_POLICY + "    - file:/etc/otelcol/config.yaml\n",
+			expected: http.StatusForbidden,
+			err:      "cannot be checked",
+		},
+		{
+			name:     "inline source within quotas",
+			policy:   TEST_QUOTA_SOURCES_POLICY,
+			expected: http.StatusCreated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			w := send("POST", POLICIES_API, tt.policy)
+
+			// Assert
+			if w.Code != tt.expected {
+				t.Errorf(ERROR_MSG, w.Code, tt.expected)
+			}
+			if !strings.Contains(w.Body.String(), tt.err) {
+				t.Errorf("Expected a %q error, got %s", tt.err, w.Body.String())
+			}
+		})
+	}
+
+	// Act get quotas status
+	w := send("GET", "/api/v1/status", "")
+	var status config.Status
+	err = json.Unmarshal(w.Body.Bytes(), &status)
+
+	// Assert
+	if err != nil {
+		t.Errorf("json.Unmarshal() error = %v", err)
+	}
+	if status.Quotas.MemoryLimiterMiB.Used != 128 || status.Quotas.ListeningPorts.Used != 1 {
+		t.Errorf("Expected the inline source to count towards the quotas, got %+v", status.Quotas)
+	}
+}
@@ -0,0 +1,152 @@
+package otlpinf
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultMaxPolicyRevisions = 10
+	authorHeader              = "X-Otlpinf-Author"
+)
+
+// Revision is a policy definition as it was applied at some point. Numbers grow by one on every
+// change and are kept when older revisions are discarded.
+type Revision struct {
+	Number    int64         `json:"revision" yaml:"revision"`
+	Timestamp time.Time     `json:"timestamp" yaml:"timestamp"`
+	Author    string        `json:"author" yaml:"author"`
+	Comment   string        `json:"comment" yaml:"comment"`
+	Policy    config.Policy `json:"-" yaml:"policy"`
+}
+
+// requestAuthor identifies who changed a policy, by the author header or the client address.
+func requestAuthor(c *gin.Context) string {
+	if author := c.GetHeader(authorHeader); author != "" {
+		return author
+	}
+	return c.ClientIP()
+}
+
+// appendRevision adds a revision for data, dropping the oldest ones beyond the configured limit.
+func (o *OltpInf) appendRevision(revisions []Revision, data config.Policy, author string, comment string) []Revision {
+	number := int64(1)
+	if len(revisions) > 0 {
+		number = revisions[len(revisions)-1].Number + 1
+	}
+	revisions = append(revisions, Revision{
+		Number:    number,
+		Timestamp: time.Now(),
+		Author:    author,
+		Comment:   comment,
+		Policy:    data,
+	})
+	max := o.conf.Limits.MaxPolicyRevisions
+	if max <= 0 {
+		max = defaultMaxPolicyRevisions
+	}
+	if len(revisions) > max {
+		revisions = append([]Revision(nil), revisions[len(revisions)-max:]...)
+	}
+	return revisions
+}
+
+// findRevision looks up a revision of rInfo by its number, replying with the error if there is none.
+func findRevision(c *gin.Context, rInfo RunnerInfo, number string) (Revision, bool) {
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"invalid revision " + number})
+		return Revision{}, false
+	}
+	for _, r := range rInfo.Revisions {
+		if r.Number == n {
+			return r, true
+		}
+	}
+	c.IndentedJSON(http.StatusNotFound, ReturnValue{"revision not found"})
+	return Revision{}, false
+}
+
+func (o *OltpInf) getRevisions(c *gin.Context) {
+	rInfo, ok := o.getRunnerInfo(c.Param("policy"))
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, rInfo.Revisions)
+}
+
+func (o *OltpInf) getRevision(c *gin.Context) {
+	rInfo, ok := o.getRunnerInfo(c.Param("policy"))
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return
+	}
+	rev, ok := findRevision(c, rInfo, c.Param("revision"))
+	if !ok {
+		return
+	}
+	o.replyYAML(c, http.StatusOK, rev)
+}
+
+// diffRevision replies with a unified diff from a revision to the one given by `to`, or to the
+// latest revision when it is omitted.
+func (o *OltpInf) diffRevision(c *gin.Context) {
+	policy := c.Param("policy")
+	rInfo, ok := o.getRunnerInfo(policy)
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return
+	}
+	from, ok := findRevision(c, rInfo, c.Param("revision"))
+	if !ok {
+		return
+	}
+	to := rInfo.Revisions[len(rInfo.Revisions)-1]
+	if n := c.Query("to"); n != "" {
+		if to, ok = findRevision(c, rInfo, n); !ok {
+			return
+		}
+	}
+	a, err := yaml.Marshal(map[string]config.Policy{policy: from.Policy})
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, ReturnValue{err.Error()})
+		return
+	}
+	b, err := yaml.Marshal(map[string]config.Policy{policy: to.Policy})
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, ReturnValue{err.Error()})
+		return
+	}
+	d, err := unifiedDiff("revision "+strconv.FormatInt(from.Number, 10), "revision "+strconv.FormatInt(to.Number, 10),
+		string(a), string(b))
+	if err != nil {
+		c.IndentedJSON(http.StatusUnprocessableEntity, ReturnValue{err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(o.secrets.Redact(d)))
+}
+
+func (o *OltpInf) rollbackPolicy(c *gin.Context) {
+	policy := c.Param("policy")
+	rInfo, ok := o.getRunnerInfo(policy)
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return
+	}
+	to := c.Query("to")
+	if to == "" {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"to query parameter is required"})
+		return
+	}
+	rev, ok := findRevision(c, rInfo, to)
+	if !ok {
+		return
+	}
+	o.replacePolicy(c, policy, rev.Policy, "rollback to revision "+to)
+}
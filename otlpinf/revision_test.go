@@ -0,0 +1,153 @@
+package otlpinf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+	"go.uber.org/zap/zaptest"
+)
+
+const TEST_REVISION_POLICY = `policy_test:
+  config:
+    receivers:
+      otlp:
+        protocols:
+          http:
+    exporters:
+      debug:
+        verbosity: %s
+    service:
+      pipelines:
+        metrics:
+          receivers: [otlp]
+          exporters: [debug]
+`
+
+func TestOtlpInfPolicyRevisions(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55689,
+		},
+		Limits: config.LimitsConfig{MaxPolicyRevisions: 3},
+	}
+
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		req.Header.Set(authorHeader, "tester")
+		otlp.router.ServeHTTP(w, req)
+		return w
+	}
+	policyAPI := POLICIES_API + "/policy_test"
+
+	// Act create and update policy
+	w := send("POST", POLICIES_API, strings.Replace(TEST_REVISION_POLICY, "%s", "basic", 1))
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+
+	// Act update policy
+	w = send("PUT", policyAPI, strings.Replace(TEST_REVISION_POLICY, "%s", "detailed", 1))
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+
+	// Act update policy with a name that does not match the path
+	w = send("PUT", POLICIES_API+"/other", strings.Replace(TEST_REVISION_POLICY, "%s", "detailed", 1))
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+
+	// Act update policy with a config the collector refuses
+	w = send("PUT", policyAPI, strings.Replace(TEST_REVISION_POLICY, "%s", "invalid", 1))
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+	if s := otlp.policies["policy_test"].Instance.GetStatus().Status; s != runner.Running {
+		t.Errorf("Expected previous runner to be running, got %v", s)
+	}
+
+	// Act list revisions
+	w = send("GET", policyAPI+"/revisions", "")
+
+	// Assert
+	var revisions []Revision
+	if err = json.Unmarshal(w.Body.Bytes(), &revisions); err != nil {
+		t.Errorf("json.Unmarshal() error = %v", err)
+	}
+	if len(revisions) != 2 || revisions[1].Number != 2 || revisions[1].Author != "tester" {
+		t.Errorf("Expected two revisions authored by tester, got %v", revisions)
+	}
+
+	// Act diff first revision against the latest
+	w = send("GET", policyAPI+"/revisions/1/diff", "")
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), "-                verbosity: basic\n+                verbosity: detailed\n") {
+		t.Errorf("Expected diff of verbosity, got %v", w.Body.String())
+	}
+
+	// Act get unknown revision
+	w = send("GET", policyAPI+"/revisions/9", "")
+
+	// Assert
+	if w.Code != http.StatusNotFound {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusNotFound)
+	}
+
+	// Act rollback to first revision
+	w = send("POST", policyAPI+"/rollback?to=1", "")
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	rInfo := otlp.policies["policy_test"]
+	if len(rInfo.Revisions) != 3 || rInfo.Revisions[2].Comment != "rollback to revision 1" {
+		t.Errorf("Expected rollback revision, got %v", rInfo.Revisions)
+	}
+
+	// Act go beyond the revisions limit
+	w = send("POST", policyAPI+"/rollback?to=2", "")
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	rInfo = otlp.policies["policy_test"]
+	if len(rInfo.Revisions) != 3 || rInfo.Revisions[0].Number != 2 {
+		t.Errorf("Expected the oldest revision to be discarded, got %v", rInfo.Revisions)
+	}
+}
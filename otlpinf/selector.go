@@ -0,0 +1,105 @@
+package otlpinf
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	labelKey   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	labelValue = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?)?$`)
+)
+
+type selectorOp int
+
+const (
+	opEquals selectorOp = iota
+	opNotEquals
+	opExists
+	opNotExists
+)
+
+type requirement struct {
+	key   string
+	op    selectorOp
+	value string
+}
+
+// selector matches labels against comma separated requirements in the forms `key=value`,
+// `key==value`, `key!=value`, `key` (the label exists) and `!key` (it does not).
+type selector []requirement
+
+func parseSelector(s string) (selector, error) {
+	sel := make(selector, 0)
+	if strings.TrimSpace(s) == "" {
+		return sel, nil
+	}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		var r requirement
+		switch {
+		case strings.Contains(term, "!="):
+			parts := strings.SplitN(term, "!=", 2)
+			r = requirement{strings.TrimSpace(parts[0]), opNotEquals, strings.TrimSpace(parts[1])}
+		case strings.Contains(term, "=="):
+			parts := strings.SplitN(term, "==", 2)
+			r = requirement{strings.TrimSpace(parts[0]), opEquals, strings.TrimSpace(parts[1])}
+		case strings.Contains(term, "="):
+			parts := strings.SplitN(term, "=", 2)
+			r = requirement{strings.TrimSpace(parts[0]), opEquals, strings.TrimSpace(parts[1])}
+		case strings.HasPrefix(term, "!"):
+			r = requirement{strings.TrimSpace(term[1:]), opNotExists, ""}
+		default:
+			r = requirement{term, opExists, ""}
+		}
+		if !labelKey.MatchString(r.key) {
+			return nil, fmt.Errorf("invalid selector requirement %q", term)
+		}
+		if !labelValue.MatchString(r.value) {
+			return nil, fmt.Errorf("invalid label value in selector requirement %q", term)
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// Matches reports whether labels satisfy every requirement of the selector.
+func (s selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		v, ok := labels[r.key]
+		switch r.op {
+		case opEquals:
+			if !ok || v != r.value {
+				return false
+			}
+		case opNotEquals:
+			if ok && v == r.value {
+				return false
+			}
+		case opExists:
+			if !ok {
+				return false
+			}
+		case opNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validateLabels checks label keys and values use the characters allowed in selectors.
+func validateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if !labelKey.MatchString(k) {
+			return errors.New("invalid label key " + k)
+		}
+		if !labelValue.MatchString(v) {
+			return fmt.Errorf("invalid value %q for label %s", v, k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package otlpinf
+
+import "testing"
+
+func TestSelectorMatches(t *testing.T) {
+	// Arrange
+	labels := map[string]string{"team": "payments", "env": "prod"}
+	tests := map[string]bool{
+		"":                         true,
+		"team=payments":            true,
+		"team==payments,env!=dev":  true,
+		"team=payments, env=dev":   false,
+		"env":                      true,
+		"!env":                     false,
+		"region!=eu,!region":       true,
+		"app.example.com/tier=web": false,
+	}
+
+	for s, expected := range tests {
+		// Act
+		sel, err := parseSelector(s)
+
+		// Assert
+		if err != nil {
+			t.Errorf("Expected no error for %q, but got %v", s, err)
+			continue
+		}
+		if sel.Matches(labels) != expected {
+			t.Errorf("Expected selector %q to match %v", s, expected)
+		}
+	}
+
+	// Act invalid selector
+	_, err := parseSelector("team=pay ments")
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an invalid selector error, but got none")
+	}
+}
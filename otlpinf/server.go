@@ -2,23 +2,35 @@ package otlpinf
 
 import (
 	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	yson "github.com/ghodss/yaml"
 	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
 	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/events"
 	"github.com/leoparente/opentelemetry-infinity/runner"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"gopkg.in/yaml.v3"
 )
 
 type ReturnPolicyData struct {
-	State runner.State `yaml:"status"`
+	State      runner.State         `yaml:"status"`
+	Stats      *runner.ProcessStats `yaml:"stats,omitempty"`
+	Generation int64                `yaml:"generation"`
 	config.Policy
 }
 
@@ -26,42 +38,163 @@ type ReturnValue struct {
 	Message string `json:"message"`
 }
 
+// ReturnStartError is the reply to a request whose policy collector failed to start.
+type ReturnStartError struct {
+	Message string             `json:"message"`
+	Error   *runner.StartError `json:"error"`
+}
+
+type LogLevel struct {
+	Level string `json:"level" binding:"required"`
+}
+
+// collectorLogLevels are the values accepted by the collector for service.telemetry.logs.level.
+var collectorLogLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
+
+var errLimitsWithoutCgroup = errors.New("memory_mb and cpu limits are only enforced with cgroup.dir configured")
+
 func (o *OltpInf) setupRouter() {
 	gin.SetMode(gin.ReleaseMode)
 	o.router = gin.New()
 
 	o.router.Use(ginzap.Ginzap(o.logger, time.RFC3339, true))
 	o.router.Use(ginzap.RecoveryWithZap(o.logger, true))
+	if o.conf.Auth.Token != "" {
+		o.router.Use(o.authenticate)
+	}
+	if o.conf.Limits.MaxRequestBodyBytes > 0 || o.conf.Limits.MaxCollectorBodyBytes > 0 {
+		o.router.Use(o.limitRequestBody)
+	}
 
 	// Routes
 	o.router.GET("/api/v1/status", o.getStatus)
+	o.router.GET("/api/v1/events", o.streamEvents)
+	o.router.GET("/api/v1/metrics", o.getMetrics)
 	o.router.GET("/api/v1/capabilities", o.getCapabilities)
+	o.router.GET("/api/v1/collectors", o.getCollectors)
+	o.router.POST("/api/v1/collectors", o.uploadCollector)
+	o.router.POST("/api/v1/collectors/:collector/migrate", o.migrateCollector)
+	o.router.GET("/api/v1/loglevel", o.getLogLevel)
+	o.router.PUT("/api/v1/loglevel", o.setLogLevel)
 	o.router.GET("/api/v1/policies", o.getPolicies)
 	o.router.POST("/api/v1/policies", o.createPolicy)
 	o.router.GET("/api/v1/policies/:policy", o.getPolicy)
+	o.router.PUT("/api/v1/policies/:policy", o.updatePolicy)
+	o.router.DELETE("/api/v1/policies", o.deletePolicies)
 	o.router.DELETE("/api/v1/policies/:policy", o.deletePolicy)
+	o.router.GET("/api/v1/policies/:policy/logs", o.getPolicyLogs)
+	o.router.GET("/api/v1/policies/:policy/stats", o.getPolicyStats)
+	o.router.POST("/api/v1/policies/:policy/pause", o.pausePolicy)
+	o.router.POST("/api/v1/policies/:policy/resume", o.resumePolicy)
+	o.router.POST("/api/v1/policies/:policy/restart", o.restartPolicy)
+	o.router.POST("/api/v1/policies/:policy/probe", o.probePolicy)
+	o.router.GET("/api/v1/policies/:policy/tap", o.tapPolicy)
+	o.router.GET("/api/v1/policies/:policy/revisions", o.getRevisions)
+	o.router.GET("/api/v1/policies/:policy/revisions/:revision", o.getRevision)
+	o.router.GET("/api/v1/policies/:policy/revisions/:revision/diff", o.diffRevision)
+	o.router.POST("/api/v1/policies/:policy/rollback", o.rollbackPolicy)
+	o.router.GET("/api/v1/fragments", o.getFragments)
+	o.router.POST("/api/v1/fragments", o.createFragment)
+	o.router.GET("/api/v1/fragments/:fragment", o.getFragment)
+	o.router.DELETE("/api/v1/fragments/:fragment", o.deleteFragment)
+	o.router.GET("/api/v1/templates", o.getTemplates)
+	o.router.POST("/api/v1/templates", o.createTemplate)
+	o.router.GET("/api/v1/templates/:template", o.getTemplate)
+	o.router.PUT("/api/v1/templates/:template", o.updateTemplate)
+	o.router.DELETE("/api/v1/templates/:template", o.deleteTemplate)
+	o.router.POST("/api/v1/templates/:template/policies", o.instantiateTemplate)
+}
+
+func (o *OltpInf) authenticate(c *gin.Context) {
+	expected := []byte("Bearer " + o.conf.Auth.Token)
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), expected) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, ReturnValue{"invalid or missing bearer token"})
+		return
+	}
+	c.Next()
 }
 
-func (o *OltpInf) startServer() {
+// limitRequestBody limits the size of request bodies, collector binaries having their own limit.
+func (o *OltpInf) limitRequestBody(c *gin.Context) {
+	limit := o.conf.Limits.MaxRequestBodyBytes
+	if c.Request.Method == http.MethodPost && c.FullPath() == "/api/v1/collectors" {
+		limit = o.conf.Limits.MaxCollectorBodyBytes
+	}
+	if limit > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	}
+	c.Next()
+}
+
+func (o *OltpInf) startServer() error {
 	o.setupRouter()
-	serverHost := o.conf.ServerHost
-	serverPort := strconv.FormatUint(o.conf.ServerPort, 10)
+	serv := net.JoinHostPort(o.conf.Server.Host, strconv.FormatUint(o.conf.Server.Port, 10))
+	srv := &http.Server{Addr: serv, Handler: o.router}
+	tlsConf := o.conf.Server.TLS
+	if tlsConf.ClientCAFile != "" {
+		ca, err := os.ReadFile(tlsConf.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return errors.New("no certificate found in " + tlsConf.ClientCAFile)
+		}
+		srv.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	}
 	go func() {
-		serv := serverHost + ":" + serverPort
-		o.logger.Info("starting otlp_inf server at: " + serv)
-		if err := o.router.Run(serv); err != nil {
+		var err error
+		if tlsConf.CertFile != "" {
+			o.logger.Info("starting otlp_inf server with TLS at: " + serv)
+			err = srv.ListenAndServeTLS(tlsConf.CertFile, tlsConf.KeyFile)
+		} else {
+			o.logger.Info("starting otlp_inf server at: " + serv)
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
 			o.logger.Fatal("shutting down the server", zap.Error(err))
 		}
 	}()
+	if o.conf.Server.Socket == "" {
+		return nil
+	}
+	_ = os.Remove(o.conf.Server.Socket)
+	listener, err := net.Listen("unix", o.conf.Server.Socket)
+	if err != nil {
+		return err
+	}
+	go func() {
+		o.logger.Info("starting otlp_inf server at unix socket: " + o.conf.Server.Socket)
+		if err := http.Serve(listener, o.router); err != nil {
+			o.logger.Error("unix socket server stopped", zap.Error(err))
+		}
+	}()
+	return nil
 }
 
 func (o *OltpInf) getStatus(c *gin.Context) {
-	o.stat.UpTime = time.Since(o.stat.StartTime)
-	c.IndentedJSON(http.StatusOK, o.stat)
+	stat := o.stat
+	stat.UpTime = time.Since(stat.StartTime)
+	stat.Quotas = o.quotaUsage("")
+	c.IndentedJSON(http.StatusOK, stat)
 }
 
 func (o *OltpInf) getCapabilities(c *gin.Context) {
-	j, err := yson.YAMLToJSON(o.capabilities)
+	// only the collector_binary and the registered collectors are run, no other executable of the host
+	binary := o.conf.CollectorBinary
+	if name := c.Query("collector"); name != "" {
+		var err error
+		if binary, err = o.collectorBinary(name); err != nil {
+			c.IndentedJSON(http.StatusNotFound, ReturnValue{err.Error()})
+			return
+		}
+	}
+	capabilities, err := o.binaryCapabilities(binary)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"failed to get collector components: " + err.Error()})
+		return
+	}
+	j, err := yson.YAMLToJSON(capabilities)
 	if err != nil {
 		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
 		return
@@ -75,81 +208,447 @@ func (o *OltpInf) getCapabilities(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, ret)
 }
 
+func (o *OltpInf) getLogLevel(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, LogLevel{o.logLevel.Level().String()})
+}
+
+func (o *OltpInf) setLogLevel(c *gin.Context) {
+	var payload LogLevel
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+		return
+	}
+	level, err := zapcore.ParseLevel(payload.Level)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+		return
+	}
+	o.logLevel.SetLevel(level)
+	o.logger.Info("log level changed", zap.String("level", level.String()))
+	c.IndentedJSON(http.StatusOK, LogLevel{level.String()})
+}
+
 func (o *OltpInf) getPolicies(c *gin.Context) {
-	policies := make([]string, 0, len(o.policies))
-	for k := range o.policies {
-		policies = append(policies, k)
+	if !hasListQuery(c) {
+		o.policiesMutex.RLock()
+		policies := make([]string, 0, len(o.policies))
+		for k := range o.policies {
+			policies = append(policies, k)
+		}
+		o.policiesMutex.RUnlock()
+		sort.Strings(policies)
+		c.IndentedJSON(http.StatusOK, policies)
+		return
 	}
-	c.IndentedJSON(http.StatusOK, policies)
+	o.listPolicies(c)
 }
 
 func (o *OltpInf) getPolicy(c *gin.Context) {
 	policy := c.Param("policy")
-	rInfo, ok := o.policies[policy]
-	if ok {
-		c.YAML(http.StatusOK, map[string]ReturnPolicyData{policy: {rInfo.Instance.GetStatus(), rInfo.Policy}})
-	} else {
+	rInfo, ok := o.getRunnerInfo(policy)
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return
+	}
+	rendered, _ := strconv.ParseBool(c.Query("rendered"))
+	etag := policyETag(rInfo.Version, rInfo.Instance.GetStatus().StatusText, rendered)
+	if matchETag(c.GetHeader("If-None-Match"), etag, true) {
+		c.Header("ETag", etag)
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if rendered {
+		var err error
+		if rInfo.Policy, err = o.inspectedPolicy(rInfo.Policy); err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, ReturnValue{err.Error()})
+			return
+		}
+	}
+	o.replyRenderedPolicy(c, http.StatusOK, policy, rInfo, rendered)
+}
+
+func (o *OltpInf) getPolicyLogs(c *gin.Context) {
+	policy := c.Param("policy")
+	rInfo, ok := o.getRunnerInfo(policy)
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return
+	}
+	logs := rInfo.Instance.Logs()
+	if tail, err := strconv.Atoi(c.Query("tail")); err == nil && tail >= 0 && tail < len(logs) {
+		logs = logs[len(logs)-tail:]
+	}
+	c.IndentedJSON(http.StatusOK, logs)
+}
+
+func (o *OltpInf) getPolicyStats(c *gin.Context) {
+	rInfo, ok := o.getRunnerInfo(c.Param("policy"))
+	if !ok {
 		c.IndentedJSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return
+	}
+	stats, err := rInfo.Instance.Stats()
+	if errors.Is(err, runner.ErrNotRunning) {
+		c.IndentedJSON(http.StatusConflict, ReturnValue{"policy is not running"})
+		return
+	} else if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, ReturnValue{err.Error()})
+		return
 	}
+	c.IndentedJSON(http.StatusOK, stats)
 }
 
-func (o *OltpInf) createPolicy(c *gin.Context) {
+// replyYAML writes v as YAML with every known secret value redacted.
+func (o *OltpInf) replyYAML(c *gin.Context, code int, v interface{}) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, ReturnValue{err.Error()})
+		return
+	}
+	c.Data(code, "application/x-yaml; charset=utf-8", []byte(o.secrets.Redact(string(b))))
+}
+
+// replyPolicy writes a policy with its runner state and sets its ETag.
+func (o *OltpInf) replyPolicy(c *gin.Context, code int, policy string, rInfo RunnerInfo) {
+	o.replyRenderedPolicy(c, code, policy, rInfo, false)
+}
+
+// replyRenderedPolicy replies with the policy, whose ETag tells whether it is rendered.
+func (o *OltpInf) replyRenderedPolicy(c *gin.Context, code int, policy string, rInfo RunnerInfo, rendered bool) {
+	data := ReturnPolicyData{State: rInfo.Instance.GetStatus(), Generation: rInfo.Generation, Policy: rInfo.Policy}
+	if stats, err := rInfo.Instance.Stats(); err == nil {
+		data.Stats = &stats
+	}
+	c.Header("ETag", policyETag(rInfo.Version, data.State.StatusText, rendered))
+	o.replyYAML(c, code, map[string]ReturnPolicyData{policy: data})
+}
+
+// bindYAML decodes a YAML request body into v, replying with the error when it fails.
+func bindYAML(c *gin.Context, v interface{}) bool {
 	if t := c.Request.Header.Get("Content-type"); t != "application/x-yaml" {
 		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"invalid Content-Type. Only 'application/x-yaml' is supported"})
-		return
+		return false
 	}
 	body, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
-		return
+		return false
 	}
-	var payload map[string]config.Policy
-	if err = yaml.Unmarshal(body, &payload); err != nil {
+	if err = yaml.Unmarshal(body, v); err != nil {
 		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+		return false
+	}
+	return true
+}
+
+func (o *OltpInf) createPolicy(c *gin.Context) {
+	var payload map[string]config.Policy
+	if !bindYAML(c, &payload) {
 		return
 	}
 	if len(payload) > 1 {
 		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"only single policy allowed per request"})
 		return
 	}
-	var policy string
-	var data config.Policy
-	for policy, data = range payload {
-		_, ok := o.policies[policy]
-		if ok {
-			c.IndentedJSON(http.StatusConflict, ReturnValue{"policy already exists"})
-			return
+	for policy, data := range payload {
+		data.Template = nil
+		o.startPolicy(c, policy, data)
+	}
+}
 
+// checkPolicy validates the policy fields, replying with the error if it is invalid.
+func checkPolicy(c *gin.Context, data *config.Policy) bool {
+	if len(data.Config) == 0 && len(data.Include) == 0 && len(data.Sources) == 0 {
+		c.IndentedJSON(http.StatusForbidden, ReturnValue{"config field is required"})
+		return false
+	}
+	for _, source := range data.Sources {
+		if err := runner.ValidateSource(source); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+			return false
 		}
-		if len(data.Config) == 0 {
-			c.IndentedJSON(http.StatusForbidden, ReturnValue{"config field is required"})
-			return
-
+	}
+	if data.LogLevel != "" && !collectorLogLevels[strings.ToLower(data.LogLevel)] {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"invalid log_level, use debug, info, warn or error"})
+		return false
+	}
+	if err := validateLabels(data.Labels); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+		return false
+	}
+	if data.Binary != "" && data.Collector != "" {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"binary and collector cannot be both set"})
+		return false
+	}
+	if data.Binary != "" {
+		if err := runner.CheckBinary(data.Binary); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+			return false
 		}
 	}
-
-	r := runner.New(o.logger, policy, o.policiesDir, o.conf.SelfTelemetry)
-	if err := r.Configure(&data); err != nil {
+	if err := validateLimits(data.Limits); err != nil {
 		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+		return false
+	}
+	return true
+}
+
+// checkLimits replies with 400 if the policy, with the policy defaults, has memory or CPU limits
+// but no cgroup is configured to enforce them.
+func (o *OltpInf) checkLimits(c *gin.Context, data config.Policy) bool {
+	if l := o.applyDefaults(data).Limits; o.conf.Cgroup.Dir == "" && l != nil && (l.MemoryMB > 0 || l.CPU > 0) {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{errLimitsWithoutCgroup.Error()})
+		return false
+	}
+	return true
+}
+
+func validateLimits(l *config.ResourceLimits) error {
+	if l == nil {
+		return nil
+	}
+	if l.MemoryMB < 0 || l.CPU < 0 {
+		return errors.New("invalid limits, memory_mb and cpu must not be negative")
+	}
+	if l.Nice != nil && (*l.Nice < -20 || *l.Nice > 19) {
+		return errors.New("invalid limits, nice must be between -20 and 19")
+	}
+	return nil
+}
+
+// newRunner creates a runner configured with the policy, the fragments it includes and the policy
+// defaults.
+func (o *OltpInf) newRunner(policy string, data config.Policy) (Runner, error) {
+	binary, err := o.collectorBinary(data.Collector)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := o.includeFragments(data)
+	if err != nil {
+		return nil, err
+	}
+	settings := RunnerSettings{Binary: binary, StartupTimeout: o.conf.PolicyDefaults.StartupTimeout,
+		CgroupDir: o.conf.Cgroup.Dir, Secrets: o.secrets, Events: o.events}
+	factory := o.runnerFactory
+	if factory == nil {
+		factory = o.newCollectorRunner
+	}
+	r := factory(policy, settings)
+	applied := o.applyDefaults(rendered)
+	if err = r.Configure(&applied); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// newCollectorRunner is the RunnerFactory running a collector process for every policy.
+func (o *OltpInf) newCollectorRunner(policy string, s RunnerSettings) Runner {
+	return runner.New(o.logger, policy, o.policiesDir, o.conf.SelfTelemetry, runner.WithBinary(s.Binary),
+		runner.WithStartupTimeout(s.StartupTimeout), runner.WithCgroup(s.CgroupDir), runner.WithSecrets(s.Secrets),
+		runner.WithEvents(s.Events))
+}
+
+func (o *OltpInf) runRunner(policy string, r Runner) error {
+	return o.redactError(r.Start(o.runnerContext(policy)))
+}
+
+// redactError removes secret values from a runner error. Start errors are kept as they are,
+// since the runner redacts the collector output they are parsed from.
+func (o *OltpInf) redactError(err error) error {
+	var startErr *runner.StartError
+	if err == nil || errors.As(err, &startErr) {
+		return err
+	}
+	return errors.New(o.secrets.Redact(err.Error()))
+}
+
+// replyRunnerError replies with the error of a runner, as a structured start error when the
+// collector failed to start.
+func replyRunnerError(c *gin.Context, err error) {
+	var startErr *runner.StartError
+	if errors.As(err, &startErr) {
+		c.IndentedJSON(http.StatusBadRequest, ReturnStartError{Message: err.Error(), Error: startErr})
+		return
+	}
+	c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+}
+
+func (o *OltpInf) runnerContext(policy string) (context.Context, context.CancelFunc) {
+	return context.WithCancel(context.WithValue(o.ctx, "routine", policy))
+}
+
+// startPolicy validates and starts a new policy runner, replying with the created policy.
+func (o *OltpInf) startPolicy(c *gin.Context, policy string, data config.Policy) {
+	o.writeMutex.Lock()
+	defer o.writeMutex.Unlock()
+	current, ok := o.getRunnerInfo(policy)
+	if !checkPreconditions(c, current, ok) {
 		return
 	}
-	runnerCtx := context.WithValue(o.ctx, "routine", policy)
-	if err := r.Start(context.WithCancel(runnerCtx)); err != nil {
+	if ok {
+		c.IndentedJSON(http.StatusConflict, ReturnValue{"policy already exists"})
+		return
+	}
+	// the policy name names its files and cgroup, so it must not hold a path
+	if !collectorName.MatchString(policy) {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"invalid policy name " + strconv.Quote(policy)})
+		return
+	}
+	if !checkPolicy(c, &data) || !o.checkLimits(c, data) || !o.checkMerge(c, data) || !o.checkQuotas(c, policy, data) {
+		return
+	}
+	r, err := o.newRunner(policy, data)
+	if err != nil {
 		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
 		return
 	}
-	o.policies[policy] = RunnerInfo{Policy: data, Instance: r}
-	c.YAML(http.StatusCreated, map[string]ReturnPolicyData{policy: {r.GetStatus(), data}})
+	if err := o.runRunner(policy, r); err != nil {
+		replyRunnerError(c, err)
+		return
+	}
+	rInfo := RunnerInfo{Policy: data, Instance: r, Generation: 1, Version: o.version.Add(1)}
+	rInfo.Revisions = o.appendRevision(nil, data, requestAuthor(c), "created")
+	o.setRunnerInfo(policy, rInfo)
+	o.publishEvent(events.Created, policy, rInfo)
+	o.replyPolicy(c, http.StatusCreated, policy, rInfo)
+}
+
+func (o *OltpInf) updatePolicy(c *gin.Context) {
+	policy := c.Param("policy")
+	var payload map[string]config.Policy
+	if !bindYAML(c, &payload) {
+		return
+	}
+	data, ok := payload[policy]
+	if len(payload) != 1 || !ok {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"payload must contain only the policy " + policy})
+		return
+	}
+	data.Template = nil
+	o.replacePolicy(c, policy, data, "updated")
+}
+
+// replacePolicy restarts a policy with new data, keeping the previous runner if the new one fails
+// to start, and records the change as a new revision.
+func (o *OltpInf) replacePolicy(c *gin.Context, policy string, data config.Policy, comment string) {
+	o.writeMutex.Lock()
+	defer o.writeMutex.Unlock()
+	rInfo, ok := o.getRunnerInfo(policy)
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return
+	}
+	if !checkPreconditions(c, rInfo, ok) {
+		return
+	}
+	if !checkPolicy(c, &data) || !o.checkLimits(c, data) || !o.checkMerge(c, data) || !o.checkQuotas(c, policy, data) {
+		return
+	}
+	rInfo, err := o.swapRunner(policy, rInfo, data, requestAuthor(c), comment)
+	if err != nil {
+		replyRunnerError(c, err)
+		return
+	}
+	o.replyPolicy(c, http.StatusOK, policy, rInfo)
+}
+
+// swapRunner starts a new runner for the policy data in place of the current one, which is kept
+// if the new one fails to start, and records the change as a new revision. The caller must hold
+// writeMutex.
+func (o *OltpInf) swapRunner(policy string, rInfo RunnerInfo, data config.Policy, author string, comment string) (RunnerInfo, error) {
+	r, err := o.replaceRunner(policy, rInfo.Instance, data)
+	if err != nil {
+		return rInfo, err
+	}
+	rInfo.Instance = r
+	rInfo.Policy = data
+	rInfo.Generation++
+	rInfo.Version = o.version.Add(1)
+	rInfo.Revisions = o.appendRevision(rInfo.Revisions, data, author, comment)
+	o.setRunnerInfo(policy, rInfo)
+	o.publishEvent(events.Updated, policy, rInfo)
+	return rInfo, nil
+}
+
+// replaceRunner starts a new runner for the policy data in place of current, which is started
+// again, or paused if it was, when the new one fails to start. The caller must hold writeMutex.
+func (o *OltpInf) replaceRunner(policy string, current Runner, data config.Policy) (Runner, error) {
+	r, err := o.newRunner(policy, data)
+	if err != nil {
+		return nil, err
+	}
+	// the previous collector is stopped first to release the ports the new one may bind to
+	paused := current.GetStatus().Status == runner.Paused
+	current.Stop(o.ctx)
+	if err := o.runRunner(policy, r); err != nil {
+		if paused {
+			current.Pause(o.ctx)
+		} else if rerr := o.runRunner(policy, current); rerr != nil {
+			o.logger.Error("failed to restore previous policy runner", zap.String("policy", policy), zap.Error(rerr))
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// applyDefaults returns a copy of the policy with the configured policy defaults merged in.
+func (o *OltpInf) applyDefaults(p config.Policy) config.Policy {
+	defaults := o.conf.PolicyDefaults
+	if len(defaults.FeatureGates) > 0 {
+		p.FeatureGates = append(append([]string{}, defaults.FeatureGates...), p.FeatureGates...)
+	}
+	if len(defaults.Set) > 0 {
+		set := make(map[string]string, len(defaults.Set)+len(p.Set))
+		for k, v := range defaults.Set {
+			set[k] = v
+		}
+		for k, v := range p.Set {
+			set[k] = v
+		}
+		p.Set = set
+	}
+	p.Limits = mergeLimits(defaults.Limits, p.Limits)
+	return p
+}
+
+// mergeLimits returns the policy limits with the unset ones taken from the default limits.
+func mergeLimits(defaults config.ResourceLimits, limits *config.ResourceLimits) *config.ResourceLimits {
+	if limits == nil {
+		if defaults == (config.ResourceLimits{}) {
+			return nil
+		}
+		return &defaults
+	}
+	merged := *limits
+	if merged.MemoryMB == 0 {
+		merged.MemoryMB = defaults.MemoryMB
+	}
+	if merged.CPU == 0 {
+		merged.CPU = defaults.CPU
+	}
+	if merged.OpenFiles == 0 {
+		merged.OpenFiles = defaults.OpenFiles
+	}
+	if merged.Nice == nil {
+		merged.Nice = defaults.Nice
+	}
+	return &merged
 }
 
 func (o *OltpInf) deletePolicy(c *gin.Context) {
 	policy := c.Param("policy")
-	r, ok := o.policies[policy]
-	if ok {
-		r.Instance.Stop(o.ctx)
-		delete(o.policies, policy)
-		c.IndentedJSON(http.StatusOK, ReturnValue{policy + " was deleted"})
-	} else {
+	o.writeMutex.Lock()
+	defer o.writeMutex.Unlock()
+	r, ok := o.getRunnerInfo(policy)
+	if !ok {
 		c.IndentedJSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return
+	}
+	if !checkPreconditions(c, r, ok) {
+		return
 	}
+	r.Instance.Stop(o.ctx)
+	o.removeRunnerInfo(policy)
+	o.publishEvent(events.Deleted, policy, r)
+	c.IndentedJSON(http.StatusOK, ReturnValue{policy + " was deleted"})
 }
@@ -0,0 +1,37 @@
+package otlpinf
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+)
+
+// inspectedPolicy returns the policy with the fragments it includes and the config sources otlpinf
+// can read, inline configs and yaml: snippets, merged into its config as the collector merges
+// them, so that quotas, probes and taps see the config the collector runs. Only the sources the
+// collector resolves itself, such as files, are left in the policy sources.
+func (o *OltpInf) inspectedPolicy(p config.Policy) (config.Policy, error) {
+	p, err := o.includeFragments(p)
+	if err != nil || len(p.Sources) == 0 {
+		return p, err
+	}
+	merged, remaining, err := runner.MergeSources(&p)
+	if err != nil {
+		return p, err
+	}
+	p.Config = merged
+	p.Sources = remaining
+	return p, nil
+}
+
+// checkMerge replies with 400 if the fragments included by the policy cannot be merged or its
+// yaml: sources cannot be parsed.
+func (o *OltpInf) checkMerge(c *gin.Context, data config.Policy) bool {
+	if _, err := o.inspectedPolicy(data); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+		return false
+	}
+	return true
+}
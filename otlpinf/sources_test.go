@@ -0,0 +1,62 @@
+package otlpinf
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+)
+
+func TestInspectedPolicy(t *testing.T) {
+	// Arrange
+	o := OltpInf{fragmentsMutex: &sync.RWMutex{}}
+	policy := config.Policy{
+		Config: map[string]interface{}{
+			"processors": map[string]interface{}{"batch": map[string]interface{}{"timeout": "5s"}},
+			"service": map[string]interface{}{"pipelines": map[string]interface{}{
+				"traces": map[string]interface{}{"receivers": []interface{}{"otlp"}, "exporters": []interface{}{"debug"}},
+			}},
+		},
+		Sources: []config.ConfigSource{
+			{Config: map[string]interface{}{
+				"service": map[string]interface{}{"pipelines": map[string]interface{}{
+					"traces": map[string]interface{}{"exporters": []interface{}{"otlp"}},
+				}},
+			}},
+			{URI: "file:/etc/otelcol/config.yaml"},
+			{URI: "yaml:processors::batch::send_batch_size: 100"},
+		},
+	}
+
+	// Act
+	p, err := o.inspectedPolicy(policy)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	expected := map[string]interface{}{
+		"processors": map[string]interface{}{"batch": map[string]interface{}{"timeout": "5s", "send_batch_size": 100}},
+		"service": map[string]interface{}{"pipelines": map[string]interface{}{
+			"traces": map[string]interface{}{"receivers": []interface{}{"otlp"}, "exporters": []interface{}{"otlp"}},
+		}},
+	}
+	if !reflect.DeepEqual(p.Config, expected) {
+		t.Errorf("Expected config %v, got %v", expected, p.Config)
+	}
+	if len(p.Sources) != 1 || p.Sources[0].URI != "file:/etc/otelcol/config.yaml" {
+		t.Errorf("Expected only the file source to be left, got %v", p.Sources)
+	}
+	if _, ok := policy.Config["processors"].(map[string]interface{})["batch"].(map[string]interface{})["send_batch_size"]; ok {
+		t.Errorf("Expected the policy config to be left unchanged, got %v", policy.Config)
+	}
+
+	// Act invalid yaml source
+	_, err = o.inspectedPolicy(config.Policy{Sources: []config.ConfigSource{{URI: "yaml:[invalid"}}})
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an error, but got none")
+	}
+}
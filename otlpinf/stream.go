@@ -0,0 +1,56 @@
+package otlpinf
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/events"
+)
+
+// eventsKeepAlive is how often a comment is sent on idle event streams, so that proxies do not
+// close them.
+const eventsKeepAlive = 15 * time.Second
+
+// publishEvent publishes a lifecycle event of a policy with its current runner state.
+func (o *OltpInf) publishEvent(eventType string, policy string, rInfo RunnerInfo) {
+	state := rInfo.Instance.GetStatus()
+	o.events.Publish(events.Event{
+		Type:            eventType,
+		Policy:          policy,
+		NewStatus:       state.StatusText,
+		RestartCount:    state.RestartCount,
+		LastRestartTime: state.LastRestartTS,
+	})
+}
+
+// streamEvents sends policy events as server-sent events until the client disconnects. The
+// policy query parameter, a comma separated list, restricts the stream to those policies.
+func (o *OltpInf) streamEvents(c *gin.Context) {
+	var policies []string
+	if p := c.Query("policy"); p != "" {
+		policies = strings.Split(p, ",")
+	}
+	sub := o.events.Subscribe(policies...)
+	defer sub.Close()
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e := <-sub.Events():
+			c.SSEvent(e.Type, e)
+		case <-keepAlive.C:
+			_, _ = io.WriteString(w, ": keep-alive\n\n")
+		case <-c.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,83 @@
+package otlpinf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestOtlpInfEventStream(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55693,
+		},
+	}
+	SERVER := fmt.Sprintf("http://%s:%v", cfg.Server.Host, cfg.Server.Port)
+
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+	time.Sleep(100 * time.Millisecond)
+
+	reqCtx, reqCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer reqCancel()
+	req, _ := http.NewRequestWithContext(reqCtx, "GET", SERVER+"/api/v1/events?policy=policy_test", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("client.Do() error = %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected event stream content type, got %v", ct)
+	}
+
+	send := func(method string, path string, body string) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		otlp.router.ServeHTTP(w, req)
+	}
+
+	// Act
+	send("POST", POLICIES_API, strings.Replace(TEST_REVISION_POLICY, "%s", "basic", 1))
+	send("POST", POLICIES_API, strings.Replace(TEST_REVISION_POLICY, "policy_test", "other", 1))
+	send("DELETE", POLICIES_API+"/policy_test", "")
+
+	// Assert
+	expected := []string{
+		`event:status`, `"old_status":"unknown","new_status":"running"`,
+		`event:created`,
+		`event:status`, `"old_status":"running","new_status":"offline"`,
+		`event:deleted`,
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for len(expected) > 0 && scanner.Scan() {
+		if strings.Contains(scanner.Text(), `"policy":"other"`) {
+			t.Errorf("Expected events of other policies to be filtered, got %v", scanner.Text())
+		}
+		if strings.Contains(scanner.Text(), expected[0]) {
+			expected = expected[1:]
+		}
+	}
+	if len(expected) > 0 {
+		t.Errorf("Expected events %v, stream ended with %v", expected, scanner.Err())
+	}
+}
@@ -0,0 +1,75 @@
+package otlpinf
+
+import (
+	"crypto/rand"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The signals an OTLP receiver accepts, named as the pipelines carrying them.
+const (
+	signalTraces  = "traces"
+	signalMetrics = "metrics"
+	signalLogs    = "logs"
+)
+
+// syntheticRequest returns an OTLP export request of the signal, encoded as protobuf, holding a
+// single span, gauge point or log record of a resource telling the policy it was sent to.
+func syntheticRequest(signal string, policy string, now time.Time) []byte {
+	resource := bytesField(nil, 1, stringAttribute("service.name", "otlpinf-probe"))
+	resource = bytesField(resource, 1, stringAttribute("otlpinf.policy", policy))
+	scope := stringField(nil, 1, "otlpinf")
+	ts := uint64(now.UnixNano())
+
+	var record []byte
+	switch signal {
+	case signalTraces:
+		traceID, spanID := make([]byte, 16), make([]byte, 8)
+		_, _ = rand.Read(traceID)
+		_, _ = rand.Read(spanID)
+		record = bytesField(record, 1, traceID)
+		record = bytesField(record, 2, spanID)
+		record = stringField(record, 5, "otlpinf probe")
+		// SPAN_KIND_INTERNAL
+		record = protowire.AppendVarint(protowire.AppendTag(record, 6, protowire.VarintType), 1)
+		record = fixed64Field(record, 7, ts)
+		record = fixed64Field(record, 8, ts)
+	case signalMetrics:
+		point := fixed64Field(nil, 3, ts)
+		point = fixed64Field(point, 4, math.Float64bits(1))
+		record = stringField(record, 1, "otlpinf.probe")
+		record = bytesField(record, 5, bytesField(nil, 1, point))
+	case signalLogs:
+		record = fixed64Field(record, 1, ts)
+		// SEVERITY_NUMBER_INFO
+		record = protowire.AppendVarint(protowire.AppendTag(record, 2, protowire.VarintType), 9)
+		record = stringField(record, 3, "INFO")
+		record = bytesField(record, 5, stringField(nil, 1, "otlpinf probe"))
+	}
+
+	// ResourceSpans, ResourceMetrics and ResourceLogs share their layout, as do their scopes
+	scoped := bytesField(nil, 1, scope)
+	scoped = bytesField(scoped, 2, record)
+	resourceData := bytesField(nil, 1, resource)
+	resourceData = bytesField(resourceData, 2, scoped)
+	return bytesField(nil, 1, resourceData)
+}
+
+func stringAttribute(key string, value string) []byte {
+	return bytesField(stringField(nil, 1, key), 2, stringField(nil, 1, value))
+}
+
+// bytesField appends a bytes field, which also holds embedded messages.
+func bytesField(b []byte, num protowire.Number, v []byte) []byte {
+	return protowire.AppendBytes(protowire.AppendTag(b, num, protowire.BytesType), v)
+}
+
+func stringField(b []byte, num protowire.Number, v string) []byte {
+	return protowire.AppendString(protowire.AppendTag(b, num, protowire.BytesType), v)
+}
+
+func fixed64Field(b []byte, num protowire.Number, v uint64) []byte {
+	return protowire.AppendFixed64(protowire.AppendTag(b, num, protowire.Fixed64Type), v)
+}
@@ -0,0 +1,289 @@
+package otlpinf
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+	"go.uber.org/zap"
+)
+
+const (
+	// tapExporter is the exporter injected into the tapped pipeline
+	tapExporter = "otlphttp/otlpinf_tap"
+	// tapDefaultRate is how many exported batches a tap streams per second by default
+	tapDefaultRate = 10
+	tapMaxRate     = 1000
+	// tapBuffer is how many batches are kept for a slow client before they are dropped
+	tapBuffer = 64
+	// tapCheckInterval is how often a tap checks that its runner was not replaced
+	tapCheckInterval = time.Second
+)
+
+// tap receives the telemetry a policy pipeline exports to the tap exporter and keeps a sample
+// of it for the client streaming it.
+type tap struct {
+	signal   string
+	pipeline string
+	runner   Runner
+	server   *http.Server
+	batches  chan []byte
+	rate     int
+	mutex    sync.Mutex
+	window   time.Time
+	count    int
+}
+
+// TapStart is the first event of a tap stream.
+type TapStart struct {
+	Signal   string `json:"signal"`
+	Pipeline string `json:"pipeline"`
+	Rate     int    `json:"rate"`
+}
+
+// ServeHTTP accepts the OTLP/HTTP JSON requests of the tap exporter, keeping at most rate of
+// them every second.
+func (t *tap) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || !json.Valid(body) {
+		http.Error(w, "invalid OTLP JSON request", http.StatusBadRequest)
+		return
+	}
+	if t.sample() {
+		select {
+		case t.batches <- body:
+		default:
+		}
+	}
+	// the telemetry is accepted even when dropped, so that the exporter does not retry it
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte("{}"))
+}
+
+func (t *tap) sample() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(t.window) >= time.Second {
+		t.window, t.count = now, 0
+	}
+	if t.count >= t.rate {
+		return false
+	}
+	t.count++
+	return true
+}
+
+// tapPolicy injects a temporary exporter into a pipeline of a running policy, restarting its
+// collector, and streams the telemetry exported to it as server-sent events until the client
+// disconnects, when the collector is restarted without it.
+func (o *OltpInf) tapPolicy(c *gin.Context) {
+	policy := c.Param("policy")
+	rate := tapDefaultRate
+	if r := c.Query("rate"); r != "" {
+		var err error
+		if rate, err = strconv.Atoi(r); err != nil || rate < 1 || rate > tapMaxRate {
+			c.IndentedJSON(http.StatusBadRequest, ReturnValue{"rate must be between 1 and " + strconv.Itoa(tapMaxRate)})
+			return
+		}
+	}
+	t, ok := o.startTap(c, policy, c.Query("signal"), c.Query("pipeline"), rate)
+	if !ok {
+		return
+	}
+	defer o.stopTap(policy, t)
+	check := time.NewTicker(tapCheckInterval)
+	defer check.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Writer.WriteHeaderNow()
+	c.SSEvent("tap", TapStart{Signal: t.signal, Pipeline: t.pipeline, Rate: t.rate})
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case b := <-t.batches:
+			c.SSEvent(t.signal, json.RawMessage(b))
+		case <-check.C:
+			if rInfo, ok := o.getRunnerInfo(policy); !ok || rInfo.Instance != t.runner {
+				c.SSEvent("end", ReturnValue{"policy was updated or deleted, the tap was removed"})
+				return false
+			}
+			_, _ = io.WriteString(w, ": keep-alive\n\n")
+		case <-c.Request.Context().Done():
+			return false
+		case <-o.ctx.Done():
+			return false
+		}
+		return true
+	})
+}
+
+// startTap restarts the collector of a policy with the tap exporter in the pipeline, replying
+// with the error if it cannot.
+func (o *OltpInf) startTap(c *gin.Context, policy string, signal string, pipeline string, rate int) (*tap, bool) {
+	o.writeMutex.Lock()
+	defer o.writeMutex.Unlock()
+	rInfo, ok := o.getRunnerInfo(policy)
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"policy not found"})
+		return nil, false
+	}
+	if _, ok := o.taps[policy]; ok {
+		c.IndentedJSON(http.StatusConflict, ReturnValue{"policy is already tapped"})
+		return nil, false
+	}
+	if rInfo.Instance.GetStatus().Status != runner.Running {
+		c.IndentedJSON(http.StatusConflict, ReturnValue{"policy is not running"})
+		return nil, false
+	}
+	inspected, err := o.inspectedPolicy(rInfo.Policy)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, ReturnValue{err.Error()})
+		return nil, false
+	}
+	pipeline, err = tapPipeline(inspected, signal, pipeline)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+		return nil, false
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, ReturnValue{err.Error()})
+		return nil, false
+	}
+	t := &tap{signal: componentType(pipeline), pipeline: pipeline, rate: rate,
+		batches: make(chan []byte, tapBuffer)}
+	t.server = &http.Server{Handler: t, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		_ = t.server.Serve(listener)
+	}()
+	// the sources are kept in their order, the tap exporter being merged after all of them
+	rendered, err := o.includeFragments(rInfo.Policy)
+	if err == nil {
+		rendered, err = withTapExporter(rendered, inspected, pipeline, "http://"+listener.Addr().String())
+	}
+	if err != nil {
+		_ = t.server.Close()
+		c.IndentedJSON(http.StatusInternalServerError, ReturnValue{err.Error()})
+		return nil, false
+	}
+	if t.runner, err = o.replaceRunner(policy, rInfo.Instance, rendered); err != nil {
+		_ = t.server.Close()
+		replyRunnerError(c, err)
+		return nil, false
+	}
+	rInfo.Instance = t.runner
+	o.setRunnerInfo(policy, rInfo)
+	o.taps[policy] = t
+	o.logger.Info("policy tapped", zap.String("policy", policy), zap.String("pipeline", pipeline))
+	return t, true
+}
+
+// stopTap restarts the collector of a policy without the tap exporter, unless its runner was
+// replaced meanwhile or otlpinf is stopping. A policy paused while tapped is left paused, with a
+// runner without the tap exporter to resume.
+func (o *OltpInf) stopTap(policy string, t *tap) {
+	o.writeMutex.Lock()
+	defer o.writeMutex.Unlock()
+	delete(o.taps, policy)
+	defer t.server.Close()
+	rInfo, ok := o.getRunnerInfo(policy)
+	if !ok || rInfo.Instance != t.runner || o.ctx.Err() != nil {
+		return
+	}
+	var r Runner
+	var err error
+	if t.runner.GetStatus().Status == runner.Paused {
+		if r, err = o.newRunner(policy, rInfo.Policy); err == nil {
+			t.runner.Stop(o.ctx)
+			r.Pause(o.ctx)
+		}
+	} else {
+		r, err = o.replaceRunner(policy, t.runner, rInfo.Policy)
+	}
+	if err != nil {
+		o.logger.Error("failed to remove policy tap", zap.String("policy", policy), zap.Error(err))
+		return
+	}
+	rInfo.Instance = r
+	o.setRunnerInfo(policy, rInfo)
+	o.logger.Info("policy tap removed", zap.String("policy", policy), zap.String("pipeline", t.pipeline))
+}
+
+// tapPipeline returns the pipeline of the policy to tap: the pipeline given, or else the pipeline
+// named as the signal or the first pipeline of the signal.
+func tapPipeline(p config.Policy, signal string, pipeline string) (string, error) {
+	service, _ := p.Config["service"].(map[string]interface{})
+	pipelines, _ := service["pipelines"].(map[string]interface{})
+	if pipeline != "" {
+		if _, ok := pipelines[pipeline]; !ok {
+			return "", errors.New("pipeline " + pipeline + " not found")
+		}
+		if signal != "" && componentType(pipeline) != signal {
+			return "", errors.New("pipeline " + pipeline + " does not carry " + signal)
+		}
+		signal = componentType(pipeline)
+	}
+	if signal != signalTraces && signal != signalMetrics && signal != signalLogs {
+		return "", errors.New("signal must be traces, metrics or logs")
+	}
+	if pipeline != "" {
+		return pipeline, nil
+	}
+	if _, ok := pipelines[signal]; ok {
+		return signal, nil
+	}
+	ids := make([]string, 0, len(pipelines))
+	for id := range pipelines {
+		if componentType(id) == signal {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return "", errors.New("policy has no " + signal + " pipeline")
+	}
+	sort.Strings(ids)
+	return ids[0], nil
+}
+
+// withTapExporter returns a copy of the policy exporting the pipeline to endpoint as well, as
+// OTLP/HTTP JSON, through a yaml: config source merged after the policy config and sources. The
+// pipeline exporters are those of inspected, the policy as otlpinf sees it, since the source
+// replaces the whole list.
+func withTapExporter(p config.Policy, inspected config.Policy, pipeline string, endpoint string) (config.Policy, error) {
+	service, _ := inspected.Config["service"].(map[string]interface{})
+	pipelines, _ := service["pipelines"].(map[string]interface{})
+	settings, _ := pipelines[pipeline].(map[string]interface{})
+	ids, _ := settings["exporters"].([]interface{})
+	snippet, err := json.Marshal(map[string]interface{}{
+		"exporters": map[string]interface{}{tapExporter: map[string]interface{}{
+			"endpoint":         endpoint,
+			"encoding":         "json",
+			"compression":      "none",
+			"retry_on_failure": map[string]interface{}{"enabled": false},
+			"sending_queue":    map[string]interface{}{"enabled": false},
+		}},
+		"service": map[string]interface{}{"pipelines": map[string]interface{}{pipeline: map[string]interface{}{
+			"exporters": append(append(make([]interface{}, 0, len(ids)+1), ids...), tapExporter),
+		}}},
+	})
+	if err != nil {
+		return p, err
+	}
+	// JSON is YAML on a single line, which the source URI is
+	p.Sources = append(append(make([]config.ConfigSource, 0, len(p.Sources)+1), p.Sources...),
+		config.ConfigSource{URI: "yaml:" + string(snippet)})
+	return p, nil
+}
@@ -0,0 +1,213 @@
+package otlpinf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestTapPipeline(t *testing.T) {
+	// Arrange
+	p := config.Policy{Config: map[string]interface{}{"service": map[string]interface{}{"pipelines": map[string]interface{}{
+		"traces/b": map[string]interface{}{}, "traces/a": map[string]interface{}{}, "metrics": map[string]interface{}{},
+	}}}}
+	tests := []struct {
+		signal   string
+		pipeline string
+		expected string
+	}{
+		{"traces", "", "traces/a"},
+		{"metrics", "", "metrics"},
+		{"", "traces/b", "traces/b"},
+		{"metrics", "traces/b", ""},
+		{"logs", "", ""},
+		{"", "", ""},
+	}
+
+	for i, test := range tests {
+		// Act
+		pipeline, err := tapPipeline(p, test.signal, test.pipeline)
+
+		// Assert
+		if pipeline != test.expected || (err == nil) != (test.expected != "") {
+			t.Errorf("Expected query %d to select %q, got %q and error %v", i, test.expected, pipeline, err)
+		}
+	}
+}
+
+func TestWithTapExporter(t *testing.T) {
+	// Arrange
+	p := config.Policy{
+		Config: map[string]interface{}{"exporters": map[string]interface{}{"debug": nil}},
+		Sources: []config.ConfigSource{
+			{URI: "file:/etc/otelcol/pipelines.yaml"},
+			{URI: "yaml:service::pipelines::traces::exporters: [debug]"},
+		},
+	}
+	inspected := config.Policy{Config: map[string]interface{}{"service": map[string]interface{}{"pipelines": map[string]interface{}{
+		"traces": map[string]interface{}{"exporters": []interface{}{"debug"}},
+	}}}}
+
+	// Act
+	tapped, err := withTapExporter(p, inspected, "traces", "http://127.0.0.1:4318")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("withTapExporter() error = %v", err)
+	}
+	if len(tapped.Sources) != 3 || !reflect.DeepEqual(tapped.Sources[:2], p.Sources) || len(p.Sources) != 2 {
+		t.Fatalf("Expected the tap source after the policy sources, got %v", tapped.Sources)
+	}
+	snippet, err := runner.ParseYAMLSource(strings.TrimPrefix(tapped.Sources[2].URI, "yaml:"))
+	if err != nil {
+		t.Fatalf("ParseYAMLSource() error = %v", err)
+	}
+	pipeline := snippet["service"].(map[string]interface{})["pipelines"].(map[string]interface{})["traces"].(map[string]interface{})
+	if ids := fmt.Sprint(pipeline["exporters"]); ids != "[debug "+tapExporter+"]" {
+		t.Errorf("Expected the tap source to export to debug and the tap, got %v", ids)
+	}
+	if !reflect.DeepEqual(tapped.Config, p.Config) {
+		t.Errorf("Expected the policy config to be kept, got %v", tapped.Config)
+	}
+}
+
+func TestOtlpInfTapPolicy(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	fakes := newFakeRunners()
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55700,
+		},
+		CollectorBinary: writeTestCollector(t),
+	}
+	SERVER := fmt.Sprintf("http://%s:%v", cfg.Server.Host, cfg.Server.Port)
+
+	otlp, err := New(logger, &cfg, WithRunnerFactory(fakes.factory))
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+	time.Sleep(100 * time.Millisecond)
+
+	send := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		otlp.router.ServeHTTP(w, req)
+		return w
+	}
+	if w := send("POST", POLICIES_API, strings.Replace(TEST_REVISION_POLICY, "%s", "basic", 1)); w.Code != http.StatusCreated {
+		t.Fatalf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+
+	// Act tap a missing pipeline
+	w := send("GET", POLICIES_API+"/policy_test/tap?pipeline=traces", "")
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+
+	// Act tap the metrics pipeline
+	reqCtx, reqCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer reqCancel()
+	req, _ := http.NewRequestWithContext(reqCtx, "GET", SERVER+POLICIES_API+"/policy_test/tap?signal=metrics&rate=2", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("client.Do() error = %v", err)
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	// the tap event is sent once the collector runs with the tap exporter
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "data:") {
+			break
+		}
+	}
+	runners := fakes.runners("policy_test")
+
+	// Assert
+	if resp.StatusCode != http.StatusOK || len(runners) != 2 {
+		t.Fatalf("Expected the policy to be restarted with the tap, got %v and %d runners", resp.StatusCode, len(runners))
+	}
+	tapped, _ := otlp.inspectedPolicy(runners[1].configured())
+	exporters, _ := tapped.Config["exporters"].(map[string]interface{})
+	tapConfig, _ := exporters[tapExporter].(map[string]interface{})
+	endpoint, _ := tapConfig["endpoint"].(string)
+	if endpoint == "" || otlp.policies["policy_test"].Policy.Config["exporters"].(map[string]interface{})[tapExporter] != nil {
+		t.Fatalf("Expected the tap exporter in the running config only, got %v", exporters)
+	}
+	pipeline := tapped.Config["service"].(map[string]interface{})["pipelines"].(map[string]interface{})["metrics"].(map[string]interface{})
+	if ids := fmt.Sprint(pipeline["exporters"]); ids != "[debug "+tapExporter+"]" {
+		t.Errorf("Expected the pipeline to export to debug and the tap, got %v", ids)
+	}
+	if w = send("GET", POLICIES_API+"/policy_test/tap?signal=metrics", ""); w.Code != http.StatusConflict {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusConflict)
+	}
+
+	// Act export to the tap
+	for i := 0; i < 3; i++ {
+		r, err := http.Post(endpoint+"/v1/metrics", "application/json", strings.NewReader(fmt.Sprintf(`{"resourceMetrics":[{"n":%d}]}`, i)))
+		if err != nil {
+			t.Fatalf("http.Post() error = %v", err)
+		}
+		r.Body.Close()
+	}
+	var data []string
+	for len(data) < 2 && scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "event:") && scanner.Text() != "event:metrics" {
+			t.Errorf("Expected metrics events, got %v", scanner.Text())
+		}
+		if d, ok := strings.CutPrefix(scanner.Text(), "data:"); ok {
+			data = append(data, d)
+		}
+	}
+
+	// Assert
+	if len(data) != 2 || data[0] != `{"resourceMetrics":[{"n":0}]}` || data[1] != `{"resourceMetrics":[{"n":1}]}` {
+		t.Errorf("Expected the first 2 exported batches, got %v", data)
+	}
+
+	// Act pause the tapped policy and disconnect
+	if w = send("POST", POLICIES_API+"/policy_test/pause", ""); w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	reqCancel()
+	removed := false
+	for i := 0; i < 100 && !removed; i++ {
+		time.Sleep(10 * time.Millisecond)
+		otlp.writeMutex.Lock()
+		removed = len(otlp.taps) == 0
+		otlp.writeMutex.Unlock()
+	}
+
+	// Assert
+	runners = fakes.runners("policy_test")
+	if !removed || len(runners) != 3 || otlp.policies["policy_test"].Instance != runners[2] {
+		t.Fatalf("Expected the policy to be restarted without the tap, got %d runners", len(runners))
+	}
+	exporters, _ = runners[2].configured().Config["exporters"].(map[string]interface{})
+	if _, ok := exporters[tapExporter]; ok {
+		t.Errorf("Expected the tap exporter to be removed, got %v", exporters)
+	}
+	if status := runners[2].GetStatus().Status; status != runner.Paused || runners[2].startCount() != 0 {
+		t.Errorf("Expected the policy to stay paused, got %v after %d starts", runner.MapStatus[status], runners[2].startCount())
+	}
+}
@@ -0,0 +1,356 @@
+package otlpinf
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	parameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	placeholder   = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	// wholePlaceholder matches strings made of a single placeholder, whose value keeps its YAML type.
+	wholePlaceholder = regexp.MustCompile(`^(\$\{[A-Za-z_][A-Za-z0-9_]*\}|\{\{\s*\.[A-Za-z_][A-Za-z0-9_]*\s*\}\})$`)
+)
+
+// templateParameters checks the given parameters against the template declaration and fills
+// the defaults of the missing ones.
+func templateParameters(t *config.Template, given map[string]string) (map[string]string, error) {
+	params := make(map[string]string, len(t.Parameters))
+	declared := make(map[string]bool, len(t.Parameters))
+	missing := make([]string, 0)
+	for _, p := range t.Parameters {
+		declared[p.Name] = true
+		if v, ok := given[p.Name]; ok {
+			params[p.Name] = v
+		} else if p.Required {
+			missing = append(missing, p.Name)
+		} else {
+			params[p.Name] = p.Default
+		}
+	}
+	if len(missing) > 0 {
+		return nil, errors.New("missing required parameters: " + strings.Join(missing, ", "))
+	}
+	unknown := make([]string, 0)
+	for name := range given {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, errors.New("unknown parameters: " + strings.Join(unknown, ", "))
+	}
+	return params, nil
+}
+
+// renderTemplate returns a new policy with every placeholder of the template replaced by params.
+// Placeholders that do not name a parameter, as the collector's own `${env:VAR}`, are kept.
+func renderTemplate(name string, t *config.Template, params map[string]string) (config.Policy, error) {
+	p := config.Policy{
+		Set:      make(map[string]string, len(t.Policy.Set)),
+		Template: &config.TemplateRef{Name: name, Version: t.Version},
+	}
+	var err error
+	for _, f := range []struct{ dst, src *string }{
+		{&p.Description, &t.Policy.Description},
+		{&p.Owner, &t.Policy.Owner},
+		{&p.LogLevel, &t.Policy.LogLevel},
+		{&p.Binary, &t.Policy.Binary},
+		{&p.Collector, &t.Policy.Collector},
+	} {
+		if *f.dst, err = expandText(*f.src, params); err != nil {
+			return p, err
+		}
+	}
+	if p.Labels, err = expandMap(t.Policy.Labels, params); err != nil {
+		return p, err
+	}
+	if p.Annotations, err = expandMap(t.Policy.Annotations, params); err != nil {
+		return p, err
+	}
+	for _, g := range t.Policy.FeatureGates {
+		gate, err := expandText(g, params)
+		if err != nil {
+			return p, err
+		}
+		p.FeatureGates = append(p.FeatureGates, gate)
+	}
+	for k, v := range t.Policy.Set {
+		key, err := expandText(k, params)
+		if err != nil {
+			return p, err
+		}
+		if p.Set[key], err = expandText(v, params); err != nil {
+			return p, err
+		}
+	}
+	for _, i := range t.Policy.Include {
+		fragment, err := expandText(i, params)
+		if err != nil {
+			return p, err
+		}
+		p.Include = append(p.Include, fragment)
+	}
+	for _, src := range t.Policy.Sources {
+		var source config.ConfigSource
+		if source.URI, err = expandText(src.URI, params); err != nil {
+			return p, err
+		}
+		if src.Config != nil {
+			c, err := expandValue(src.Config, params)
+			if err != nil {
+				return p, err
+			}
+			source.Config = c.(map[string]interface{})
+		}
+		p.Sources = append(p.Sources, source)
+	}
+	if t.Policy.Limits != nil {
+		limits := *t.Policy.Limits
+		if limits.Nice != nil {
+			nice := *limits.Nice
+			limits.Nice = &nice
+		}
+		p.Limits = &limits
+	}
+	c, err := expandValue(t.Policy.Config, params)
+	if err != nil {
+		return p, err
+	}
+	p.Config, _ = c.(map[string]interface{})
+	return p, nil
+}
+
+func expandText(s string, params map[string]string) (string, error) {
+	if strings.Contains(s, "{{") {
+		tmpl, err := template.New("").Option("missingkey=error").Parse(s)
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		if err = tmpl.Execute(&b, params); err != nil {
+			return "", err
+		}
+		s = b.String()
+	}
+	return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		if v, ok := params[m[2:len(m)-1]]; ok {
+			return v
+		}
+		return m
+	}), nil
+}
+
+func expandMap(m map[string]string, params map[string]string) (map[string]string, error) {
+	if m == nil {
+		return nil, nil
+	}
+	ret := make(map[string]string, len(m))
+	for k, v := range m {
+		key, err := expandText(k, params)
+		if err != nil {
+			return nil, err
+		}
+		if ret[key], err = expandText(v, params); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func expandValue(v interface{}, params map[string]string) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		s, err := expandText(t, params)
+		if err != nil || s == t || !wholePlaceholder.MatchString(t) {
+			return s, err
+		}
+		var typed interface{}
+		if yaml.Unmarshal([]byte(s), &typed) == nil {
+			switch typed.(type) {
+			case int, float64, bool:
+				return typed, nil
+			}
+		}
+		return s, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			key, err := expandText(k, params)
+			if err != nil {
+				return nil, err
+			}
+			if m[key], err = expandValue(e, params); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i, e := range t {
+			var err error
+			if l[i], err = expandValue(e, params); err != nil {
+				return nil, err
+			}
+		}
+		return l, nil
+	default:
+		return v, nil
+	}
+}
+
+// validateTemplate checks the parameter declarations and that the policy renders with them.
+func validateTemplate(t *config.Template) error {
+	if len(t.Policy.Config) == 0 && len(t.Policy.Include) == 0 && len(t.Policy.Sources) == 0 {
+		return errors.New("policy config field is required")
+	}
+	params := make(map[string]string, len(t.Parameters))
+	for _, p := range t.Parameters {
+		if !parameterName.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if _, ok := params[p.Name]; ok {
+			return fmt.Errorf("duplicated parameter %q", p.Name)
+		}
+		params[p.Name] = p.Default
+	}
+	_, err := renderTemplate("", t, params)
+	return err
+}
+
+// bindTemplate reads a single template from a request, replying with the error if it is invalid.
+func (o *OltpInf) bindTemplate(c *gin.Context) (string, *config.Template, bool) {
+	var payload map[string]config.Template
+	if !bindYAML(c, &payload) {
+		return "", nil, false
+	}
+	if len(payload) != 1 {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"only single template allowed per request"})
+		return "", nil, false
+	}
+	for name, t := range payload {
+		if err := validateTemplate(&t); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+			return "", nil, false
+		}
+		return name, &t, true
+	}
+	return "", nil, false
+}
+
+func (o *OltpInf) getTemplates(c *gin.Context) {
+	o.templatesMutex.RLock()
+	defer o.templatesMutex.RUnlock()
+	templates := make([]string, 0, len(o.templates))
+	for k := range o.templates {
+		templates = append(templates, k)
+	}
+	sort.Strings(templates)
+	c.IndentedJSON(http.StatusOK, templates)
+}
+
+func (o *OltpInf) getTemplate(c *gin.Context) {
+	name := c.Param("template")
+	o.templatesMutex.RLock()
+	t, ok := o.templates[name]
+	o.templatesMutex.RUnlock()
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"template not found"})
+		return
+	}
+	o.replyYAML(c, http.StatusOK, map[string]config.Template{name: t})
+}
+
+func (o *OltpInf) createTemplate(c *gin.Context) {
+	name, t, ok := o.bindTemplate(c)
+	if !ok {
+		return
+	}
+	t.Version = 1
+	o.templatesMutex.Lock()
+	_, exists := o.templates[name]
+	if !exists {
+		o.templates[name] = *t
+	}
+	o.templatesMutex.Unlock()
+	if exists {
+		c.IndentedJSON(http.StatusConflict, ReturnValue{"template already exists"})
+		return
+	}
+	o.replyYAML(c, http.StatusCreated, map[string]config.Template{name: *t})
+}
+
+func (o *OltpInf) updateTemplate(c *gin.Context) {
+	name, t, ok := o.bindTemplate(c)
+	if !ok {
+		return
+	}
+	if name != c.Param("template") {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"template name does not match the request path"})
+		return
+	}
+	o.templatesMutex.Lock()
+	current, ok := o.templates[name]
+	if ok {
+		t.Version = current.Version + 1
+		o.templates[name] = *t
+	}
+	o.templatesMutex.Unlock()
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"template not found"})
+		return
+	}
+	o.replyYAML(c, http.StatusOK, map[string]config.Template{name: *t})
+}
+
+func (o *OltpInf) deleteTemplate(c *gin.Context) {
+	name := c.Param("template")
+	o.templatesMutex.Lock()
+	defer o.templatesMutex.Unlock()
+	if _, ok := o.templates[name]; !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"template not found"})
+		return
+	}
+	delete(o.templates, name)
+	c.IndentedJSON(http.StatusOK, ReturnValue{name + " was deleted"})
+}
+
+func (o *OltpInf) instantiateTemplate(c *gin.Context) {
+	name := c.Param("template")
+	o.templatesMutex.RLock()
+	t, ok := o.templates[name]
+	o.templatesMutex.RUnlock()
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, ReturnValue{"template not found"})
+		return
+	}
+	var instance config.TemplateInstance
+	if !bindYAML(c, &instance) {
+		return
+	}
+	if instance.Name == "" {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"policy name is required"})
+		return
+	}
+	params, err := templateParameters(&t, instance.Parameters)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+		return
+	}
+	policy, err := renderTemplate(name, &t, params)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+		return
+	}
+	o.startPolicy(c, instance.Name, policy)
+}
@@ -0,0 +1,307 @@
+package otlpinf
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"go.uber.org/zap/zaptest"
+)
+
+const (
+	TEMPLATES_API = "/api/v1/templates"
+	TEST_TEMPLATE = `otlp_template:
+  parameters:
+    - name: endpoint
+      required: true
+    - name: limit
+      default: "512"
+  policy:
+    set:
+      exporters.otlp.timeout: ${timeout}
+    config:
+      exporters:
+        otlp:
+          endpoint: "{{ .endpoint }}:4317"
+          headers:
+            api-key: ${env:API_KEY}
+      processors:
+        memory_limiter:
+          limit_mib: ${limit}
+`
+)
+
+func newTestTemplate() *config.Template {
+	return &config.Template{
+		Version: 2,
+		Parameters: []config.TemplateParameter{
+			{Name: "endpoint", Required: true},
+			{Name: "limit", Default: "512"},
+		},
+		Policy: config.Policy{
+			Set: map[string]string{"processors.batch.timeout": "${limit}s"},
+			Config: map[string]interface{}{
+				"exporters": map[string]interface{}{
+					"otlp/${endpoint}": map[string]interface{}{
+						"endpoint": "{{ .endpoint }}:4317",
+						"headers":  []interface{}{"${env:API_KEY}"},
+					},
+				},
+				"processors": map[string]interface{}{
+					"memory_limiter": map[string]interface{}{
+						"limit_mib": "${limit}",
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestTemplateParameters(t *testing.T) {
+	// Arrange
+	tmpl := newTestTemplate()
+
+	// Act
+	params, err := templateParameters(tmpl, map[string]string{"endpoint": "collector"})
+
+	// Assert
+	if err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+	expected := map[string]string{"endpoint": "collector", "limit": "512"}
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected parameters to be %v, got %v", expected, params)
+	}
+
+	// Act missing required parameter
+	_, err = templateParameters(tmpl, map[string]string{"limit": "1"})
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "endpoint") {
+		t.Errorf("Expected a missing endpoint error, but got: %v", err)
+	}
+
+	// Act unknown parameter
+	_, err = templateParameters(tmpl, map[string]string{"endpoint": "collector", "other": "1"})
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "other") {
+		t.Errorf("Expected an unknown parameter error, but got: %v", err)
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	// Arrange
+	tmpl := newTestTemplate()
+	params := map[string]string{"endpoint": "collector", "limit": "256"}
+
+	// Act
+	policy, err := renderTemplate("test", tmpl, params)
+
+	// Assert
+	if err != nil {
+		t.Errorf("Expected no error, but got %v", err)
+	}
+	exporter := policy.Config["exporters"].(map[string]interface{})["otlp/collector"].(map[string]interface{})
+	if exporter["endpoint"] != "collector:4317" {
+		t.Errorf("Expected endpoint to be collector:4317, got %v", exporter["endpoint"])
+	}
+	if exporter["headers"].([]interface{})[0] != "${env:API_KEY}" {
+		t.Errorf("Expected collector placeholders to be kept, got %v", exporter["headers"])
+	}
+	limiter := policy.Config["processors"].(map[string]interface{})["memory_limiter"].(map[string]interface{})
+	if limiter["limit_mib"] != 256 {
+		t.Errorf("Expected limit_mib to be the integer 256, got %#v", limiter["limit_mib"])
+	}
+	if policy.Set["processors.batch.timeout"] != "256s" {
+		t.Errorf("Expected set to be rendered, got %v", policy.Set)
+	}
+	if policy.Template == nil || policy.Template.Name != "test" || policy.Template.Version != 2 {
+		t.Errorf("Expected template reference test version 2, got %v", policy.Template)
+	}
+	if _, ok := tmpl.Policy.Config["exporters"].(map[string]interface{})["otlp/${endpoint}"]; !ok {
+		t.Errorf("Expected template to be unchanged")
+	}
+}
+
+func TestOtlpInfTemplateApis(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55688,
+		},
+	}
+
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+
+	otlp.setupRouter()
+
+	// Act create template
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", TEMPLATES_API, bytes.NewBuffer([]byte(TEST_TEMPLATE)))
+	req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+
+	// Act create same template
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", TEMPLATES_API, bytes.NewBuffer([]byte(TEST_TEMPLATE)))
+	req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusConflict {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusConflict)
+	}
+
+	// Act update template
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", TEMPLATES_API+"/otlp_template", bytes.NewBuffer([]byte(TEST_TEMPLATE)))
+	req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	if otlp.templates["otlp_template"].Version != 2 {
+		t.Errorf("Expected template version 2, got %v", otlp.templates["otlp_template"].Version)
+	}
+
+	// Act instantiate without required parameter
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", TEMPLATES_API+"/otlp_template/policies", bytes.NewBuffer([]byte("name: policy_test\n")))
+	req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+
+	// Act create template with undeclared parameter
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", TEMPLATES_API, bytes.NewBuffer([]byte("invalid:\n  policy:\n    config:\n      a: \"{{ .b }}\"\n")))
+	req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+
+	// Act delete template
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", TEMPLATES_API+"/otlp_template", nil)
+	otlp.router.ServeHTTP(w, req)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+}
+
+func TestOtlpInfConcurrentTemplates(t *testing.T) {
+	// Arrange
+	otlp, err := New(zaptest.NewLogger(t), &config.Config{})
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	otlp.setupRouter()
+	send := func(method string, path string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer([]byte(TEST_TEMPLATE)))
+		req.Header.Set("Content-Type", HTTP_YAML_CONTENT)
+		otlp.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Act create the same template concurrently
+	codes := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- send("POST", TEMPLATES_API)
+			send("PUT", TEMPLATES_API+"/otlp_template")
+			send("GET", TEMPLATES_API)
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	// Assert
+	created := 0
+	for code := range codes {
+		if code == http.StatusCreated {
+			created++
+		}
+	}
+	if created != 1 {
+		t.Errorf("Expected the template to be created once, got %d", created)
+	}
+}
+
+func TestRenderTemplateFields(t *testing.T) {
+	// Arrange
+	nice := 5
+	tmpl := &config.Template{
+		Parameters: []config.TemplateParameter{{Name: "env", Default: "prod"}},
+		Policy: config.Policy{
+			Include: []string{"exporters_${env}"},
+			Limits:  &config.ResourceLimits{OpenFiles: 1024, Nice: &nice},
+			Binary:  "/opt/otelcol-${env}/otelcol",
+			Sources: []config.ConfigSource{
+				{URI: "file:/etc/otelcol/${env}.yaml"},
+				{Config: map[string]interface{}{"processors": map[string]interface{}{"attributes/${env}": nil}}},
+			},
+		},
+	}
+	params := map[string]string{"env": "staging"}
+
+	// Act
+	err := validateTemplate(tmpl)
+	policy, rerr := renderTemplate("test", tmpl, params)
+
+	// Assert
+	if err != nil || rerr != nil {
+		t.Fatalf("Expected no error, but got %v and %v", err, rerr)
+	}
+	if !reflect.DeepEqual(policy.Include, []string{"exporters_staging"}) {
+		t.Errorf("Expected the included fragments to be rendered, got %v", policy.Include)
+	}
+	if len(policy.Sources) != 2 || policy.Sources[0].URI != "file:/etc/otelcol/staging.yaml" ||
+		!reflect.DeepEqual(policy.Sources[1].Config, map[string]interface{}{"processors": map[string]interface{}{"attributes/staging": nil}}) {
+		t.Errorf("Expected the config sources to be rendered, got %v", policy.Sources)
+	}
+	if policy.Limits == nil || policy.Limits.OpenFiles != 1024 || policy.Limits.Nice == &nice || *policy.Limits.Nice != 5 {
+		t.Errorf("Expected a copy of the template limits, got %v", policy.Limits)
+	}
+	if policy.Binary != "/opt/otelcol-staging/otelcol" {
+		t.Errorf("Expected the binary to be rendered, got %v", policy.Binary)
+	}
+
+	// Act select a collector instead of a binary
+	tmpl.Policy.Binary, tmpl.Policy.Collector = "", "otelcol-${env}"
+	policy, err = renderTemplate("test", tmpl, params)
+
+	// Assert
+	if err != nil || policy.Collector != "otelcol-staging" || policy.Binary != "" {
+		t.Errorf("Expected the collector to be rendered, got %q and error %v", policy.Collector, err)
+	}
+}
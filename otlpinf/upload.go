@@ -0,0 +1,263 @@
+package otlpinf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+	"go.uber.org/zap"
+)
+
+var errInvalidSignature = errors.New("invalid collector signature")
+
+// startCollectorUpload prepares the directory uploaded collectors are stored in, registering the
+// collectors uploaded before otlpinf restarted, and loads the public key verifying their signatures.
+func (o *OltpInf) startCollectorUpload() error {
+	upload := o.conf.CollectorUpload
+	if upload.PublicKeyFile != "" {
+		key, err := loadPublicKey(upload.PublicKeyFile)
+		if err != nil {
+			return err
+		}
+		o.publicKey = key
+	}
+	if upload.Dir != "" {
+		dir, err := filepath.Abs(upload.Dir)
+		if err != nil {
+			return err
+		}
+		o.uploadDir = dir
+		if err = os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+		return o.loadUploadedCollectors()
+	}
+	dir, err := os.MkdirTemp("", "collectors")
+	if err != nil {
+		return err
+	}
+	o.uploadDir = dir
+	o.removeUploadDir = true
+	return nil
+}
+
+// loadUploadedCollectors registers the collectors stored in the upload directory. Their signatures
+// were checked on upload and are not stored, so only their checksums are recorded again. Binaries
+// that no longer run their components command are skipped, as are the names of configured
+// collectors, which take precedence.
+func (o *OltpInf) loadUploadedCollectors() error {
+	entries, err := os.ReadDir(o.uploadDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		binary := filepath.Join(o.uploadDir, name)
+		if strings.HasPrefix(name, ".upload-") {
+			// an upload interrupted by the restart
+			_ = os.Remove(binary)
+			continue
+		}
+		if !e.Type().IsRegular() || !collectorName.MatchString(name) || name == defaultCollector {
+			continue
+		}
+		if _, ok := o.getCollector(name); ok {
+			o.logger.Warn("uploaded collector skipped, a configured collector has its name", zap.String("collector", name))
+			continue
+		}
+		sum, err := fileSHA256(binary)
+		if err != nil {
+			return err
+		}
+		collector, err := o.registerCollector(name, binary)
+		if err != nil {
+			o.logger.Warn("uploaded collector skipped", zap.String("collector", name), zap.Error(err))
+			continue
+		}
+		collector.SHA256 = sum
+		o.collectorsMutex.Lock()
+		o.collectors[name] = collector
+		o.collectorsMutex.Unlock()
+		o.logger.Info("uploaded collector loaded", zap.String("collector", name), zap.String("version", collector.Version),
+			zap.String("sha256", sum))
+	}
+	return nil
+}
+
+func fileSHA256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func loadPublicKey(file string) (crypto.PublicKey, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM public key found in " + file)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %w", file, err)
+	}
+	return key, nil
+}
+
+// verifySignature checks the signature of the SHA-256 digest of a collector binary: PKCS #1 v1.5
+// for RSA keys, ASN.1 for ECDSA keys, as `openssl dgst -sha256 -sign` produces them, and the
+// signature of the digest itself for Ed25519 keys.
+func verifySignature(key crypto.PublicKey, digest []byte, signature []byte) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, signature) != nil {
+			return errInvalidSignature
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest, signature) {
+			return errInvalidSignature
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, digest, signature) {
+			return errInvalidSignature
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+	return nil
+}
+
+// uploadCollector stores the collector binary of the request body, checked against the sha256
+// and signature query parameters, and registers it as name, or as its version when no name is
+// given, once its components command succeeds.
+func (o *OltpInf) uploadCollector(c *gin.Context) {
+	expected, err := hex.DecodeString(c.Query("sha256"))
+	if err != nil || len(expected) != sha256.Size {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"sha256 query parameter must be the hex SHA-256 of the binary"})
+		return
+	}
+	var signature []byte
+	if s := c.Query("signature"); s != "" {
+		if signature, err = base64.StdEncoding.DecodeString(s); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, ReturnValue{"signature query parameter must be base64 encoded"})
+			return
+		}
+	} else if o.publicKey != nil {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"signature query parameter is required"})
+		return
+	}
+	name := c.Query("name")
+	if name != "" && !checkCollectorName(c, name) {
+		return
+	}
+	if _, ok := o.getCollector(name); ok {
+		c.IndentedJSON(http.StatusConflict, ReturnValue{"collector " + name + " already exists"})
+		return
+	}
+
+	f, err := os.CreateTemp(o.uploadDir, ".upload-")
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, ReturnValue{err.Error()})
+		return
+	}
+	defer os.Remove(f.Name())
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), c.Request.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		var maxBytes *http.MaxBytesError
+		if errors.As(err, &maxBytes) {
+			c.IndentedJSON(http.StatusRequestEntityTooLarge, ReturnValue{err.Error()})
+			return
+		}
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{err.Error()})
+		return
+	}
+	digest := h.Sum(nil)
+	if !bytes.Equal(digest, expected) {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"sha256 mismatch, the binary is " + hex.EncodeToString(digest)})
+		return
+	}
+	if o.publicKey != nil {
+		if err = verifySignature(o.publicKey, digest, signature); err != nil {
+			c.IndentedJSON(http.StatusForbidden, ReturnValue{err.Error()})
+			return
+		}
+	}
+	if err = os.Chmod(f.Name(), 0o755); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, ReturnValue{err.Error()})
+		return
+	}
+	capabilities, err := runner.GetCapabilities(f.Name())
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"invalid collector binary, components failed: " + err.Error()})
+		return
+	}
+	components, err := runner.ParseComponents(capabilities)
+	if err != nil || components.Buildinfo.Version == "" {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"invalid collector binary, components output has no version"})
+		return
+	}
+	if name == "" {
+		name = strings.TrimPrefix(components.Buildinfo.Version, "v")
+		if !checkCollectorName(c, name) {
+			return
+		}
+	}
+
+	collector := Collector{Name: name, Binary: filepath.Join(o.uploadDir, name), Version: components.Buildinfo.Version,
+		SHA256: hex.EncodeToString(digest), Components: components.Names()}
+	o.collectorsMutex.Lock()
+	defer o.collectorsMutex.Unlock()
+	if _, ok := o.collectors[name]; ok {
+		c.IndentedJSON(http.StatusConflict, ReturnValue{"collector " + name + " already exists"})
+		return
+	}
+	if err = os.Rename(f.Name(), collector.Binary); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, ReturnValue{err.Error()})
+		return
+	}
+	o.collectors[name] = collector
+	o.logger.Info("collector uploaded", zap.String("collector", name), zap.String("version", collector.Version),
+		zap.String("sha256", collector.SHA256))
+	c.IndentedJSON(http.StatusCreated, collector)
+}
+
+func checkCollectorName(c *gin.Context, name string) bool {
+	if !collectorName.MatchString(name) {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{fmt.Sprintf("invalid collector name %q", name)})
+		return false
+	}
+	if name == defaultCollector {
+		c.IndentedJSON(http.StatusBadRequest, ReturnValue{"collector name " + defaultCollector + " is reserved"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,224 @@
+package otlpinf
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestVerifySignature(t *testing.T) {
+	// Arrange
+	digest := sha256.Sum256([]byte(TEST_COLLECTOR))
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() error = %v", err)
+	}
+	ecSignature, err := ecdsa.SignASN1(rand.Reader, ecPrivate, digest[:])
+	if err != nil {
+		t.Fatalf("ecdsa.SignASN1() error = %v", err)
+	}
+
+	// Act and Assert
+	if err = verifySignature(edPublic, digest[:], ed25519.Sign(edPrivate, digest[:])); err != nil {
+		t.Errorf("verifySignature() error = %v", err)
+	}
+	if err = verifySignature(&ecPrivate.PublicKey, digest[:], ecSignature); err != nil {
+		t.Errorf("verifySignature() error = %v", err)
+	}
+	if err = verifySignature(edPublic, digest[:], ecSignature); err != errInvalidSignature {
+		t.Errorf("Expected an invalid signature error, but got %v", err)
+	}
+}
+
+func TestOtlpInfUploadCollector(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatalf("x509.MarshalPKIXPublicKey() error = %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "collectors.pub")
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+	cfg := config.Config{
+		Server: config.ServerConfig{
+			Host: TEST_HOST,
+			Port: 55697,
+		},
+		CollectorUpload: config.CollectorUploadConfig{PublicKeyFile: keyFile},
+	}
+
+	otlp, err := New(logger, &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = otlp.Start(ctx, cancel); err != nil {
+		t.Errorf("Start() error = %v", err)
+	}
+	defer otlp.Stop(ctx)
+
+	send := func(method string, path string, contentType string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		otlp.router.ServeHTTP(w, req)
+		return w
+	}
+	digest := sha256.Sum256([]byte(TEST_COLLECTOR))
+	upload := func(sum []byte, signature []byte) *httptest.ResponseRecorder {
+		q := url.Values{}
+		q.Set("sha256", hex.EncodeToString(sum))
+		if signature != nil {
+			q.Set("signature", base64.StdEncoding.EncodeToString(signature))
+		}
+		return send("POST", "/api/v1/collectors?"+q.Encode(), "application/octet-stream", TEST_COLLECTOR)
+	}
+	if w := send("POST", POLICIES_API, HTTP_YAML_CONTENT, strings.Replace(TEST_REVISION_POLICY, "%s", "basic", 1)); w.Code != http.StatusCreated {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+
+	// Act upload with another checksum
+	wrong := sha256.Sum256([]byte("otelcol"))
+	w := upload(wrong[:], ed25519.Sign(private, wrong[:]))
+
+	// Assert
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "sha256 mismatch") {
+		t.Errorf("Expected a sha256 mismatch, got %v %s", w.Code, w.Body.String())
+	}
+
+	// Act upload without signature
+	w = upload(digest[:], nil)
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusBadRequest)
+	}
+
+	// Act upload with an invalid signature
+	w = upload(digest[:], ed25519.Sign(private, wrong[:]))
+
+	// Assert
+	if w.Code != http.StatusForbidden {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusForbidden)
+	}
+
+	// Act upload signed collector
+	w = upload(digest[:], ed25519.Sign(private, digest[:]))
+	var collector Collector
+	err = json.Unmarshal(w.Body.Bytes(), &collector)
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusCreated)
+	}
+	if err != nil {
+		t.Errorf("json.Unmarshal() error = %v", err)
+	}
+	if collector.Name != "0.200.0" || collector.SHA256 != hex.EncodeToString(digest[:]) {
+		t.Errorf("Expected collector 0.200.0 with its checksum, got %+v", collector)
+	}
+
+	// Act upload the same version again
+	w = upload(digest[:], ed25519.Sign(private, digest[:]))
+
+	// Assert
+	if w.Code != http.StatusConflict {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusConflict)
+	}
+
+	// Act migrate policies
+	w = send("POST", "/api/v1/collectors/0.200.0/migrate", "", "")
+	var migration Migration
+	err = json.Unmarshal(w.Body.Bytes(), &migration)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Errorf(ERROR_MSG, w.Code, http.StatusOK)
+	}
+	if err != nil || len(migration.Migrated) != 1 || migration.Migrated[0] != "policy_test" {
+		t.Errorf("Expected policy_test to be migrated, got %+v", migration)
+	}
+	rInfo := otlp.policies["policy_test"]
+	if rInfo.Policy.Collector != "0.200.0" || rInfo.Instance.GetStatus().Status != runner.Running || rInfo.Generation != 2 {
+		t.Errorf("Expected policy_test running on collector 0.200.0, got %+v", rInfo.Policy)
+	}
+
+	// Act migrate policies again
+	w = send("POST", "/api/v1/collectors/0.200.0/migrate", "", "")
+	err = json.Unmarshal(w.Body.Bytes(), &migration)
+
+	// Assert
+	if err != nil || len(migration.Migrated) != 0 || len(migration.Skipped) != 1 {
+		t.Errorf("Expected policy_test to be skipped, got %+v", migration)
+	}
+}
+
+func TestOtlpInfLoadUploadedCollectors(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	for name, content := range map[string]string{"canary": TEST_COLLECTOR, "broken": "#!/bin/sh\nexit 1\n", ".upload-123": "partial"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o755); err != nil {
+			t.Fatalf("os.WriteFile() error = %v", err)
+		}
+	}
+	cfg := config.Config{
+		CollectorBinary: writeTestCollector(t),
+		CollectorUpload: config.CollectorUploadConfig{Dir: dir},
+	}
+	otlp, err := New(zaptest.NewLogger(t), &cfg)
+	if err != nil {
+		t.Errorf(NEW_ERR_MSG, err)
+	}
+	if err = otlp.startCollectors(); err != nil {
+		t.Fatalf("startCollectors() error = %v", err)
+	}
+
+	// Act
+	err = otlp.startCollectorUpload()
+
+	// Assert
+	if err != nil {
+		t.Fatalf("startCollectorUpload() error = %v", err)
+	}
+	digest := sha256.Sum256([]byte(TEST_COLLECTOR))
+	collector, ok := otlp.getCollector("canary")
+	if !ok || collector.Version != "0.200.0" || collector.SHA256 != hex.EncodeToString(digest[:]) {
+		t.Errorf("Expected the uploaded canary collector with its checksum, got %+v", collector)
+	}
+	if _, ok = otlp.getCollector("broken"); ok {
+		t.Errorf("Expected the broken collector to be skipped")
+	}
+	if _, err = os.Stat(filepath.Join(dir, ".upload-123")); !os.IsNotExist(err) {
+		t.Errorf("Expected the interrupted upload to be removed, got %v", err)
+	}
+}
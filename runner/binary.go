@@ -0,0 +1,99 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/amenzhinsky/go-memexec"
+)
+
+// WithBinary runs the collector executable at path, such as a distribution built with the
+// OpenTelemetry Collector Builder, instead of the embedded otelcol-contrib. A policy binary
+// takes precedence over it.
+func WithBinary(path string) Option {
+	return func(r *Runner) {
+		r.binary = path
+	}
+}
+
+// CheckBinary returns an error if path is not an absolute path to an executable file.
+func CheckBinary(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("collector binary %s must be an absolute path", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("collector binary %s: %w", path, err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+		return errors.New("collector binary " + path + " is not an executable file")
+	}
+	return nil
+}
+
+// sharedExec is an executable extracted in memory once and shared by all the commands running it.
+// It is released when the last of them is done, so that it does not take memory while no
+// collector runs.
+type sharedExec struct {
+	mutex sync.Mutex
+	b     []byte
+	exe   *memexec.Exec
+	refs  int
+}
+
+// embedded is the embedded otelcol-contrib, shared by every runner.
+var embedded = &sharedExec{b: otel_contrib}
+
+// acquire returns the executable, extracting it if no one holds it. Every acquire must be paired
+// with a release.
+func (s *sharedExec) acquire() (*memexec.Exec, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.exe == nil {
+		exe, err := memexec.New(s.b)
+		if err != nil {
+			return nil, err
+		}
+		s.exe = exe
+	}
+	s.refs++
+	return s.exe, nil
+}
+
+func (s *sharedExec) release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.refs--
+	if s.refs == 0 {
+		_ = s.exe.Close()
+		s.exe = nil
+	}
+}
+
+// command returns the command running the collector binary, or the embedded otelcol-contrib when
+// binary is empty, and a function to release the binary once the command has exited.
+func command(ctx context.Context, binary string, args ...string) (*exec.Cmd, func(), error) {
+	if binary != "" {
+		return exec.CommandContext(ctx, binary, args...), func() {}, nil
+	}
+	shared := embedded
+	exe, err := shared.acquire()
+	if err != nil {
+		return nil, nil, err
+	}
+	var once sync.Once
+	return exe.CommandContext(ctx, args...), func() { once.Do(shared.release) }, nil
+}
+
+// collectorBinary returns the binary the runner starts, empty for the embedded otelcol-contrib.
+func (r *Runner) collectorBinary() string {
+	if r.policyBinary != "" {
+		return r.policyBinary
+	}
+	return r.binary
+}
@@ -0,0 +1,204 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+// TEST_BINARY is a collector distribution that only knows the otlp receiver and debug exporter.
+const TEST_BINARY = `#!/bin/sh
+if [ "$1" = "components" ]; then
+  printf 'buildinfo:\n  command: otelcol-custom\n  version: 0.0.1\nreceivers:\n  - name: otlp\nexporters:\n  - name: debug\n'
+  exit 0
+fi
+echo "Everything is ready" >&2
+exec sleep 60
+`
+
+func writeTestBinary(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "otelcol-custom")
+	if err := os.WriteFile(path, []byte(TEST_BINARY), 0o755); err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	return path
+}
+
+func TestCheckBinary(t *testing.T) {
+	// Arrange
+	binary := writeTestBinary(t)
+	notExecutable := filepath.Join(t.TempDir(), "otelcol")
+	if err := os.WriteFile(notExecutable, []byte(TEST_BINARY), 0o644); err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+
+	// Act and Assert
+	if err := CheckBinary(binary); err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	for _, invalid := range []string{"otelcol-custom", notExecutable, filepath.Dir(binary), binary + ".missing"} {
+		if err := CheckBinary(invalid); err == nil {
+			t.Errorf("Expected an invalid binary error for %s, but got none", invalid)
+		}
+	}
+}
+
+func TestRunnerBinary(t *testing.T) {
+	// Arrange
+	binary := writeTestBinary(t)
+	r := New(zaptest.NewLogger(t), TEST_POLICY, POLICY_DIR, false, WithBinary("/nonexistent/otelcol"))
+	err := r.Configure(&config.Policy{Config: map[string]interface{}{"policy": "value1"}, Binary: binary})
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+
+	// Act
+	caps, err := GetCapabilities(binary)
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	components, err := ParseComponents(caps)
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if components.Buildinfo.Command != "otelcol-custom" || len(components.Receivers) != 1 {
+		t.Errorf("Expected the otelcol-custom components, got %+v", components)
+	}
+
+	// Act
+	ctx, cancel := context.WithCancel(context.Background())
+	err = r.Start(ctx, cancel)
+	status := r.GetStatus().Status
+	r.Stop(ctx)
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if status != Running {
+		t.Errorf("Expected the policy binary to be running, got %v", MapStatus[status])
+	}
+}
+
+func TestGetCapabilitiesOutputLimit(t *testing.T) {
+	// Arrange
+	binary := filepath.Join(t.TempDir(), "otelcol-verbose")
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\nexec yes\n"), 0o755); err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+
+	// Act
+	_, err := GetCapabilities(binary)
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("Expected an output size error, but got %v", err)
+	}
+}
+
+func TestSharedExec(t *testing.T) {
+	// Arrange
+	s := &sharedExec{b: []byte(TEST_BINARY)}
+
+	// Act
+	first, err := s.acquire()
+	if err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	second, err := s.acquire()
+	if err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	s.release()
+
+	// Assert
+	if first != second || s.exe != first {
+		t.Errorf("Expected the executable to be shared while referenced")
+	}
+
+	// Act
+	s.release()
+
+	// Assert
+	if s.exe != nil || s.refs != 0 {
+		t.Errorf("Expected the executable to be released with its last reference, got %d references", s.refs)
+	}
+}
+
+// BenchmarkRunnerStart measures creating a policy, from configuring its runner to its collector
+// running, while the collector of another policy runs. The extracted variant gives every start its
+// own copy of the embedded binary, as runners did before sharing it. memfd-B/op is the size of the
+// in-memory executables held once the collector runs.
+func BenchmarkRunnerStart(b *testing.B) {
+	policy := &config.Policy{Config: map[string]interface{}{"policy": "value1"}}
+	for _, bench := range []struct {
+		name   string
+		shared bool
+	}{{"extracted", false}, {"shared", true}} {
+		b.Run(bench.name, func(b *testing.B) {
+			original := embedded
+			defer func() { embedded = original }()
+			ctx := context.Background()
+			running := New(zap.NewNop(), "running", b.TempDir(), false)
+			if err := running.Configure(policy); err != nil {
+				b.Fatal(err)
+			}
+			runningCtx, cancel := context.WithCancel(ctx)
+			if err := running.Start(runningCtx, cancel); err != nil {
+				b.Fatal(err)
+			}
+			defer running.Stop(ctx)
+			dir := b.TempDir()
+			var memfd int64
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !bench.shared {
+					embedded = &sharedExec{b: otel_contrib}
+				}
+				r := New(zap.NewNop(), TEST_POLICY, dir, false, WithStartupTimeout(10*time.Millisecond))
+				if err := r.Configure(policy); err != nil {
+					b.Fatal(err)
+				}
+				runnerCtx, cancel := context.WithCancel(ctx)
+				if err := r.Start(runnerCtx, cancel); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				memfd += memfdBytes(b)
+				r.Stop(ctx)
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(memfd)/float64(b.N), "memfd-B/op")
+		})
+	}
+}
+
+// memfdBytes returns the size of the memory files, such as the extracted executables, open in the
+// process.
+func memfdBytes(b *testing.B) int64 {
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		b.Skip("memory files are only listed on linux: ", err)
+	}
+	var size int64
+	for _, fd := range fds {
+		path := filepath.Join("/proc/self/fd", fd.Name())
+		if target, err := os.Readlink(path); err != nil || !strings.HasPrefix(target, "/memfd:") {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"gopkg.in/yaml.v3"
+)
+
+type Component struct {
+	Name string `yaml:"name"`
+}
+
+// Components is the output of the collector `components` command.
+type Components struct {
+	Buildinfo struct {
+		Command     string `yaml:"command"`
+		Description string `yaml:"description"`
+		Version     string `yaml:"version"`
+	} `yaml:"buildinfo"`
+	Receivers  []Component `yaml:"receivers"`
+	Processors []Component `yaml:"processors"`
+	Exporters  []Component `yaml:"exporters"`
+	Connectors []Component `yaml:"connectors"`
+	Extensions []Component `yaml:"extensions"`
+}
+
+func ParseComponents(capabilities []byte) (Components, error) {
+	var c Components
+	if err := yaml.Unmarshal(capabilities, &c); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+func (c Components) byKind() map[string][]Component {
+	return map[string][]Component{
+		"receivers":  c.Receivers,
+		"processors": c.Processors,
+		"exporters":  c.Exporters,
+		"connectors": c.Connectors,
+		"extensions": c.Extensions,
+	}
+}
+
+// Missing returns the components referenced in the policy config, merged with its inline and
+// yaml: sources, that are not available in the collector, as `kind/type` entries. When a yaml:
+// source cannot be parsed, only the policy config is checked and the collector reports the source.
+func (c Components) Missing(p *config.Policy) []string {
+	merged, _, err := MergeSources(p)
+	if err != nil {
+		merged = p.Config
+	}
+	missing := make([]string, 0)
+	for kind, available := range c.byKind() {
+		section, ok := merged[kind].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for id := range section {
+			typ, _, _ := strings.Cut(id, "/")
+			found := false
+			for _, a := range available {
+				if a.Name == typ {
+					found = true
+					break
+				}
+			}
+			if !found {
+				missing = append(missing, fmt.Sprintf("%s/%s", kind, typ))
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Names returns the names of the available components by kind.
+func (c Components) Names() map[string][]string {
+	names := make(map[string][]string)
+	for kind, available := range c.byKind() {
+		names[kind] = make([]string, 0, len(available))
+		for _, a := range available {
+			names[kind] = append(names[kind], a.Name)
+		}
+	}
+	return names
+}
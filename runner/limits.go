@@ -0,0 +1,55 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// WithCgroup places the collectors with memory or CPU limits in a child cgroup, named after the
+// policy, of the cgroup v2 directory dir.
+func WithCgroup(dir string) Option {
+	return func(r *Runner) {
+		r.cgroupRoot = dir
+	}
+}
+
+// limitEnv returns the environment of a collector with the given limits. Go collectors keep their
+// heap under GOMEMLIMIT, set below the memory limit so that the garbage collector runs before the
+// cgroup kills the process.
+func limitEnv(memoryMB int64) []string {
+	if memoryMB <= 0 {
+		return nil
+	}
+	return append(os.Environ(), fmt.Sprintf("GOMEMLIMIT=%dMiB", memoryMB*9/10))
+}
+
+// prepareLimits sets up cmd to start under the runner limits, memory and CPU being only enforced
+// in a cgroup. The returned cgroup directory, if any, must be closed once the process is started.
+func (r *Runner) prepareLimits(cmd *exec.Cmd) (*os.File, error) {
+	cmd.Env = limitEnv(r.limits.MemoryMB)
+	if err := r.wrapLimits(cmd); err != nil {
+		return nil, err
+	}
+	if r.limits.MemoryMB <= 0 && r.limits.CPU <= 0 {
+		return nil, nil
+	}
+	if r.cgroupRoot == "" {
+		return nil, errors.New("memory and cpu limits require a cgroup")
+	}
+	f, err := r.setupCgroup(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up policy cgroup: %w", err)
+	}
+	return f, nil
+}
+
+// limitError describes why a collector that exited was killed by its limits, or returns an empty
+// string if it was not.
+func (r *Runner) limitError() string {
+	if r.cgroup == "" || r.oomKills() <= r.oomKillsAtStart {
+		return ""
+	}
+	return fmt.Sprintf("killed for exceeding the memory limit of %d MiB", r.limits.MemoryMB)
+}
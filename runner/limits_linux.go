@@ -0,0 +1,145 @@
+//go:build linux
+
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// cpuPeriod is the cgroup cpu.max period, in microseconds, the CPU quota is given for.
+const cpuPeriod = 100000
+
+// setupCgroup creates the policy cgroup with its memory and CPU limits, and makes cmd start in
+// it. The returned cgroup directory must be closed once the process is started.
+func (r *Runner) setupCgroup(cmd *exec.Cmd) (*os.File, error) {
+	// controllers must be enabled in the parent to be available in the child cgroups
+	if err := os.WriteFile(filepath.Join(r.cgroupRoot, "cgroup.subtree_control"), []byte("+memory +cpu"), 0o644); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(r.cgroupRoot, r.policyName)
+	// a name such as .. would place the limits outside of the delegated cgroup
+	if filepath.Dir(dir) != filepath.Clean(r.cgroupRoot) || filepath.Base(dir) != r.policyName {
+		return nil, fmt.Errorf("invalid cgroup name %q", r.policyName)
+	}
+	if err := os.Mkdir(dir, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, err
+	}
+	memory := "max"
+	if r.limits.MemoryMB > 0 {
+		memory = strconv.FormatInt(r.limits.MemoryMB*1024*1024, 10)
+	}
+	cpu := "max"
+	if r.limits.CPU > 0 {
+		cpu = strconv.FormatInt(int64(r.limits.CPU*cpuPeriod), 10)
+	}
+	for file, value := range map[string]string{"memory.max": memory, "cpu.max": cpu + " " + strconv.Itoa(cpuPeriod)} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0o644); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{UseCgroupFD: true, CgroupFD: int(f.Fd())}
+	r.cgroup = dir
+	r.oomKillsAtStart = r.oomKills()
+	return f, nil
+}
+
+// limitsExec is the name otlpinf runs itself as to set the open files limit and the nice value of
+// a collector, since neither can be set between the fork and the exec of a command: the process
+// applies them to itself and then executes the collector, which keeps its pid and cgroup.
+const limitsExec = "otlpinf-limits"
+
+func init() {
+	if len(os.Args) > 4 && os.Args[0] == limitsExec {
+		execWithLimits(os.Args[1], os.Args[2], os.Args[3], os.Args[4:])
+	}
+}
+
+// wrapLimits makes cmd run the collector through limitsExec when the runner has an open files
+// limit or a nice value.
+func (r *Runner) wrapLimits(cmd *exec.Cmd) error {
+	if r.limits.OpenFiles == 0 && r.limits.Nice == nil {
+		return nil
+	}
+	nice := ""
+	if r.limits.Nice != nil {
+		nice = strconv.Itoa(*r.limits.Nice)
+	}
+	cmd.Args = append([]string{limitsExec, strconv.FormatUint(r.limits.OpenFiles, 10), nice, cmd.Path}, cmd.Args...)
+	// resolved by the child, so that it is the running otlpinf even if its file was replaced
+	cmd.Path = "/proc/self/exe"
+	return nil
+}
+
+// execWithLimits applies the open files limit and the nice value to the process and executes the
+// collector binary with argv. Errors are printed the way the collector does so that they are
+// reported as limits start errors.
+func execWithLimits(openFiles string, nice string, binary string, argv []string) {
+	// the nice value is a thread attribute on linux, it must be set on the thread executing the collector
+	runtime.LockOSThread()
+	if err := setLimits(openFiles, nice); err != nil {
+		fmt.Fprintln(os.Stderr, "Error: failed to apply policy limits: "+err.Error())
+		os.Exit(1)
+	}
+	err := syscall.Exec(binary, argv, os.Environ())
+	fmt.Fprintln(os.Stderr, "Error: failed to execute "+binary+": "+err.Error())
+	os.Exit(1)
+}
+
+func setLimits(openFiles string, nice string) error {
+	if n, _ := strconv.ParseUint(openFiles, 10, 64); n > 0 {
+		// syscall.Setrlimit keeps Go from restoring its original limit on exec
+		if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: n, Max: n}); err != nil {
+			return fmt.Errorf("failed to limit open files: %w", err)
+		}
+	}
+	if nice != "" {
+		n, err := strconv.Atoi(nice)
+		if err != nil {
+			return err
+		}
+		if err = unix.Setpriority(unix.PRIO_PROCESS, 0, n); err != nil {
+			return fmt.Errorf("failed to set nice value: %w", err)
+		}
+	}
+	return nil
+}
+
+// oomKills returns the number of processes of the policy cgroup killed for exceeding memory.max.
+func (r *Runner) oomKills() int64 {
+	f, err := os.Open(filepath.Join(r.cgroup, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if v, ok := strings.CutPrefix(scanner.Text(), "oom_kill "); ok {
+			n, _ := strconv.ParseInt(v, 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+// removeCgroup deletes the policy cgroup once its collector has exited.
+func (r *Runner) removeCgroup() {
+	if r.cgroup != "" {
+		_ = os.Remove(r.cgroup)
+		r.cgroup = ""
+	}
+}
@@ -0,0 +1,165 @@
+//go:build linux
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRunnerOpenFilesLimit(t *testing.T) {
+	// Arrange
+	r := New(zaptest.NewLogger(t), TEST_POLICY, POLICY_DIR, false)
+	err := r.Configure(&config.Policy{
+		Config: map[string]interface{}{"policy": "value1"},
+		Limits: &config.ResourceLimits{OpenFiles: 256},
+	})
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+
+	// Act
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = r.Start(ctx, cancel); err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	stats, err := r.Stats()
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	limits, err := os.ReadFile(fmt.Sprintf("/proc/%d/limits", stats.PID))
+	r.Stop(ctx)
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	for _, line := range strings.Split(string(limits), "\n") {
+		if strings.HasPrefix(line, "Max open files") && len(strings.Fields(line)) > 4 && strings.Fields(line)[3] != "256" {
+			t.Errorf("Expected open files limit to be 256, got %s", line)
+		}
+	}
+}
+
+// TEST_LIMITS_BINARY is a collector printing the limits it started with.
+const TEST_LIMITS_BINARY = `#!/bin/sh
+echo "open files $(ulimit -n) nice $(cut -d' ' -f19 /proc/$$/stat)" >&2
+exec sleep 60
+`
+
+func TestRunnerLimitsBeforeExec(t *testing.T) {
+	// Arrange
+	binary := filepath.Join(t.TempDir(), "otelcol-limits")
+	if err := os.WriteFile(binary, []byte(TEST_LIMITS_BINARY), 0o755); err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	nice := 5
+	r := New(zaptest.NewLogger(t), TEST_POLICY, POLICY_DIR, false, WithBinary(binary))
+	err := r.Configure(&config.Policy{
+		Config: map[string]interface{}{"policy": "value1"},
+		Limits: &config.ResourceLimits{OpenFiles: 128, Nice: &nice},
+	})
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+
+	// Act
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = r.Start(ctx, cancel); err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	logs := r.Logs()
+	r.Stop(ctx)
+
+	// Assert
+	if len(logs) == 0 || logs[0] != "open files 128 nice 5" {
+		t.Errorf("Expected the collector to start with its limits, got %v", logs)
+	}
+}
+
+func TestRunnerSetupCgroup(t *testing.T) {
+	// Arrange
+	root := t.TempDir()
+	r := New(zaptest.NewLogger(t), TEST_POLICY, POLICY_DIR, false, WithCgroup(root))
+	r.limits = config.ResourceLimits{MemoryMB: 256, CPU: 0.5}
+	cmd := exec.Command("true")
+
+	// Act
+	f, err := r.prepareLimits(cmd)
+
+	// Assert
+	if err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	defer f.Close()
+	dir := filepath.Join(root, TEST_POLICY)
+	for file, expected := range map[string]string{"memory.max": "268435456", "cpu.max": "50000 100000"} {
+		if b, _ := os.ReadFile(filepath.Join(dir, file)); string(b) != expected {
+			t.Errorf("Expected %s to be %s, got %s", file, expected, string(b))
+		}
+	}
+	if cmd.SysProcAttr == nil || !cmd.SysProcAttr.UseCgroupFD {
+		t.Errorf("Expected the collector to start in the policy cgroup")
+	}
+	if !strings.Contains(strings.Join(cmd.Env, " "), "GOMEMLIMIT=230MiB") {
+		t.Errorf("Expected GOMEMLIMIT to be set below the memory limit")
+	}
+
+	// Act
+	err = os.WriteFile(filepath.Join(dir, "memory.events"), []byte("low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n"), 0o644)
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if msg := r.limitError(); msg != "killed for exceeding the memory limit of 256 MiB" {
+		t.Errorf("Expected a memory limit error, got %q", msg)
+	}
+}
+
+func TestRunnerSetupCgroupName(t *testing.T) {
+	// Arrange
+	root := filepath.Join(t.TempDir(), "delegated")
+	if err := os.Mkdir(root, 0o755); err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	for _, name := range []string{"..", ".", "a/../.."} {
+		r := New(zaptest.NewLogger(t), name, POLICY_DIR, false, WithCgroup(root))
+		r.limits = config.ResourceLimits{MemoryMB: 256}
+
+		// Act
+		_, err := r.prepareLimits(exec.Command("true"))
+
+		// Assert
+		if err == nil {
+			t.Errorf("Expected an error for the cgroup of policy %q, but got none", name)
+		}
+	}
+	for _, dir := range []string{root, filepath.Dir(root)} {
+		if _, err := os.Stat(filepath.Join(dir, "memory.max")); err == nil {
+			t.Errorf("Expected no limits to be written in %s", dir)
+		}
+	}
+}
+
+func TestRunnerLimitsWithoutCgroup(t *testing.T) {
+	// Arrange
+	r := New(zaptest.NewLogger(t), TEST_POLICY, POLICY_DIR, false)
+	r.limits = config.ResourceLimits{CPU: 0.5}
+
+	// Act
+	_, err := r.prepareLimits(exec.Command("true"))
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an error for cpu limits without a cgroup, but got none")
+	}
+}
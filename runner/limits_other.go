@@ -0,0 +1,26 @@
+//go:build !linux
+
+package runner
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func (r *Runner) setupCgroup(cmd *exec.Cmd) (*os.File, error) {
+	return nil, errors.New("cgroups are only available on linux")
+}
+
+func (r *Runner) wrapLimits(cmd *exec.Cmd) error {
+	if r.limits.OpenFiles > 0 || r.limits.Nice != nil {
+		return errors.New("open files and nice limits are only available on linux")
+	}
+	return nil
+}
+
+func (r *Runner) oomKills() int64 {
+	return 0
+}
+
+func (r *Runner) removeCgroup() {}
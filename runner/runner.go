@@ -2,18 +2,23 @@ package runner
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	_ "embed"
 	"time"
 
-	"github.com/amenzhinsky/go-memexec"
 	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/events"
+	"github.com/leoparente/opentelemetry-infinity/secrets"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 )
@@ -21,6 +26,15 @@ import (
 //go:embed otelcol-contrib
 var otel_contrib []byte
 
+const (
+	maxLogLines           = 200
+	maxLogLineSize        = 1024 * 1024
+	defaultStartupTimeout = 1 * time.Second
+	// capabilitiesTimeout and maxCapabilitiesSize bound the components command of a collector
+	capabilitiesTimeout = 10 * time.Second
+	maxCapabilitiesSize = 4 * 1024 * 1024
+)
+
 type Status int
 
 const (
@@ -28,6 +42,7 @@ const (
 	Running
 	RunnerError
 	Offline
+	Paused
 )
 
 var MapStatus = map[Status]string{
@@ -35,89 +50,307 @@ var MapStatus = map[Status]string{
 	Running:     "running",
 	RunnerError: "runner_error",
 	Offline:     "offline",
+	Paused:      "paused",
 }
 
 type State struct {
-	Status        Status    `yaml:"-"`
-	StatusText    string    `yaml:"status"`
+	Status        Status    `yaml:"-" json:"-"`
+	StatusText    string    `yaml:"status" json:"status"`
 	startTime     time.Time `yaml:"start_time"`
-	RestartCount  int64     `yaml:"restart_count"`
-	LastLog       string    `yaml:"-"`
-	LastError     string    `yaml:"last_error"`
-	LastRestartTS time.Time `yaml:"last_restart_time"`
+	RestartCount  int64     `yaml:"restart_count" json:"restart_count"`
+	LastLog       string    `yaml:"-" json:"-"`
+	LastError     string    `yaml:"last_error" json:"last_error"`
+	LastRestartTS time.Time `yaml:"last_restart_time" json:"last_restart_time"`
 }
 
 type Runner struct {
-	logger        *zap.Logger
-	policyName    string
-	policyDir     string
-	policyFile    string
-	featureGates  string
-	sets          []string
-	options       []string
-	selfTelemetry bool
-	state         State
-	cancelFunc    context.CancelFunc
-	ctx           context.Context
-	cmd           *exec.Cmd
-	errChan       chan string
-}
-
-func GetCapabilities() ([]byte, error) {
-	exe, err := memexec.New(otel_contrib)
+	logger         *zap.Logger
+	policyName     string
+	policyDir      string
+	policyFile     string
+	featureGates   string
+	sets           []string
+	options        []string
+	selfTelemetry  bool
+	binary         string
+	policyBinary   string
+	startupTimeout time.Duration
+	secrets        *secrets.Store
+	events         *events.Bus
+	state          State
+	cancelFunc     context.CancelFunc
+	ctx            context.Context
+	cmd            *exec.Cmd
+	errChan        chan *StartError
+	done           chan struct{}
+	pid            int
+	limits         config.ResourceLimits
+	cgroupRoot     string
+	// cgroup is the directory of the policy cgroup while the collector runs in it
+	cgroup          string
+	oomKillsAtStart int64
+	mutex           sync.RWMutex
+	logs            []string
+	// sources are the config sources given to the collector after policyFile
+	sources []string
+	// sourceFiles are the files written for the inline sources
+	sourceFiles []string
+}
+
+type Option func(*Runner)
+
+// WithStartupTimeout sets how long a collector must stay up for Start to consider it running.
+func WithStartupTimeout(d time.Duration) Option {
+	return func(r *Runner) {
+		if d > 0 {
+			r.startupTimeout = d
+		}
+	}
+}
+
+// GetCapabilities returns the output of the `components` command of the collector binary, or of
+// the embedded otelcol-contrib when binary is empty. The command is killed if it runs longer than
+// capabilitiesTimeout or prints more than maxCapabilitiesSize bytes.
+func GetCapabilities(binary string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), capabilitiesTimeout)
+	defer cancel()
+	cmd, release, err := command(ctx, binary, "components")
 	if err != nil {
 		return nil, err
 	}
-	defer exe.Close()
-	cmd := exe.Command("components")
-	ret, err := cmd.Output()
-	if err != nil {
+	defer release()
+	out := &limitedBuffer{max: maxCapabilitiesSize}
+	cmd.Stdout = out
+	// children of the command holding its output open must not keep it waiting
+	cmd.WaitDelay = time.Second
+	if err = cmd.Run(); err != nil {
+		if out.exceeded {
+			return nil, fmt.Errorf("components output exceeds %d bytes", maxCapabilitiesSize)
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("components command did not finish within %v", capabilitiesTimeout)
+		}
 		return nil, err
 	}
-	return ret, nil
+	return out.buf.Bytes(), nil
 }
 
-func New(logger *zap.Logger, policyName string, policyDir string, selfTelemetry bool) Runner {
-	return Runner{logger: logger, policyName: policyName, policyDir: policyDir,
-		selfTelemetry: selfTelemetry, sets: make([]string, 0), errChan: make(chan string)}
+// limitedBuffer is a buffer failing the writes beyond max bytes. The buffer is not embedded, as
+// its ReadFrom would let io.Copy bypass Write.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int
+	exceeded bool
 }
 
-func (r *Runner) Configure(c *config.Policy) error {
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > b.max {
+		b.exceeded = true
+		return 0, errors.New("output too large")
+	}
+	return b.buf.Write(p)
+}
+
+// WithSecrets resolves `${secret:name}` references in the policy config when it is written
+// for the collector, and redacts their values from the collector logs.
+func WithSecrets(store *secrets.Store) Option {
+	return func(r *Runner) {
+		r.secrets = store
+	}
+}
+
+// WithEvents publishes the status changes of the runner to bus.
+func WithEvents(bus *events.Bus) Option {
+	return func(r *Runner) {
+		r.events = bus
+	}
+}
+
+func New(logger *zap.Logger, policyName string, policyDir string, selfTelemetry bool, opts ...Option) *Runner {
+	r := &Runner{logger: logger, policyName: policyName, policyDir: policyDir, selfTelemetry: selfTelemetry,
+		startupTimeout: defaultStartupTimeout, sets: make([]string, 0)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// ConfigFile is a config file Configure writes for the collector.
+type ConfigFile struct {
+	Path    string
+	Content []byte
+}
+
+// Render returns the collector config file content and the command line arguments that
+// Configure produces for the policy, using policyFile as the config file path.
+func Render(c *config.Policy, policyFile string, selfTelemetry bool) ([]byte, []string, error) {
+	files, options, err := RenderFiles(c, policyFile, selfTelemetry)
+	if err != nil {
+		return nil, nil, err
+	}
+	return files[0].Content, options, nil
+}
+
+// RenderFiles returns the config files, the policy one first and then one per inline source, and
+// the command line arguments that Configure produces for the policy, using policyFile as the
+// policy config file path.
+func RenderFiles(c *config.Policy, policyFile string, selfTelemetry bool) ([]ConfigFile, []string, error) {
 	b, err := yaml.Marshal(&c.Config)
 	if err != nil {
+		return nil, nil, err
+	}
+	files := []ConfigFile{{Path: policyFile, Content: b}}
+	r := Runner{policyFile: policyFile, selfTelemetry: selfTelemetry}
+	for i, source := range c.Sources {
+		if err = ValidateSource(source); err != nil {
+			return nil, nil, err
+		}
+		if source.Config == nil {
+			r.sources = append(r.sources, source.URI)
+			continue
+		}
+		if b, err = yaml.Marshal(&source.Config); err != nil {
+			return nil, nil, err
+		}
+		path := policyFile + "-source-" + strconv.Itoa(i+1)
+		files = append(files, ConfigFile{Path: path, Content: b})
+		r.sources = append(r.sources, path)
+	}
+	r.setOptions(c)
+	return files, r.options, nil
+}
+
+// Validate runs the collector `validate` command over the policy configured as Configure would do it.
+func Validate(policyName string, policyDir string, c *config.Policy, selfTelemetry bool, opts ...Option) error {
+	r := New(zap.NewNop(), policyName, policyDir, selfTelemetry, opts...)
+	if err := r.Configure(c); err != nil {
 		return err
 	}
-	f, err := os.CreateTemp(r.policyDir, r.policyName)
+	defer r.removeConfigFiles()
+
+	cmd, release, err := command(context.Background(), r.collectorBinary(), append([]string{"validate"}, r.options...)...)
 	if err != nil {
 		return err
 	}
-	if _, err = f.Write(b); err != nil {
+	defer release()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(r.secrets.Redact(string(out))); msg != "" {
+			return errors.New(msg)
+		}
 		return err
 	}
-	r.policyFile = f.Name()
-	if err = f.Close(); err != nil {
+	return nil
+}
+
+func (r *Runner) Configure(c *config.Policy) error {
+	for k, v := range c.Set {
+		if secrets.HasReference(v) {
+			return errors.New("secret references are only supported in config, set " + k + " would expose it in the command line")
+		}
+	}
+	for _, source := range c.Sources {
+		if err := ValidateSource(source); err != nil {
+			return err
+		}
+	}
+	var err error
+	if r.policyFile, err = r.writeConfig(r.policyName, c.Config); err != nil {
 		return err
 	}
+	r.sources = make([]string, 0, len(c.Sources))
+	r.sourceFiles = make([]string, 0)
+	for _, source := range c.Sources {
+		if source.Config == nil {
+			r.sources = append(r.sources, source.URI)
+			continue
+		}
+		file, err := r.writeConfig(r.policyName+"-source", source.Config)
+		if err != nil {
+			return err
+		}
+		r.sourceFiles = append(r.sourceFiles, file)
+		r.sources = append(r.sources, file)
+	}
+	r.policyBinary = c.Binary
+	r.limits = config.ResourceLimits{}
+	if c.Limits != nil {
+		r.limits = *c.Limits
+	}
+
+	r.setOptions(c)
+
+	return nil
+}
+
+// writeConfig writes a collector config, with its secret references resolved, to a new file of
+// the policy directory and returns its path.
+func (r *Runner) writeConfig(pattern string, cfg map[string]interface{}) (string, error) {
+	var policyConfig interface{} = cfg
+	if r.secrets != nil {
+		var err error
+		if policyConfig, err = r.secrets.Resolve(cfg); err != nil {
+			return "", err
+		}
+	}
+	b, err := yaml.Marshal(policyConfig)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(r.policyDir, pattern)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	// the rendered config may hold resolved secrets, only otlpinf user must be able to read it
+	if err = f.Chmod(0o600); err != nil {
+		return "", err
+	}
+	if _, err = f.Write(b); err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
 
+func (r *Runner) removeConfigFiles() {
+	os.Remove(r.policyFile)
+	for _, f := range r.sourceFiles {
+		os.Remove(f)
+	}
+}
+
+func (r *Runner) setOptions(c *config.Policy) {
 	if c.FeatureGates != nil {
 		r.featureGates = strings.Join(c.FeatureGates, ",")
 	}
 
-	if c.Set != nil {
-		for k, v := range c.Set {
-			r.sets = append(r.sets, strings.Join([]string{"--set", k, v}, "="))
-		}
+	r.sets = make([]string, 0, len(c.Set))
+	keys := make([]string, 0, len(c.Set))
+	for k := range c.Set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		r.sets = append(r.sets, strings.Join([]string{"--set", k, c.Set[k]}, "="))
 	}
 
 	r.options = []string{
 		"--config",
 		r.policyFile,
 	}
+	// the collector merges the configs in order, the later ones overriding the earlier ones
+	for _, source := range r.sources {
+		r.options = append(r.options, "--config", source)
+	}
 
 	if !r.selfTelemetry {
 		r.options = append(r.options, "--set=service.telemetry.metrics.level=None")
 	}
 
+	if c.LogLevel != "" {
+		r.options = append(r.options, "--set=service.telemetry.logs.level="+strings.ToUpper(c.LogLevel))
+	}
+
 	if len(r.featureGates) > 0 {
 		r.options = append(r.options, "--feature-gates", r.featureGates)
 	}
@@ -125,89 +358,215 @@ func (r *Runner) Configure(c *config.Policy) error {
 	if len(r.sets) > 0 {
 		r.options = append(r.options, r.sets...)
 	}
-
-	return nil
 }
 
 func (r *Runner) Start(ctx context.Context, cancelFunc context.CancelFunc) error {
 	r.cancelFunc = cancelFunc
 	r.ctx = ctx
 
-	exe, err := memexec.New(otel_contrib)
+	cmd, release, err := command(ctx, r.collectorBinary(), r.options...)
 	if err != nil {
 		return err
 	}
-	defer exe.Close()
+	// the binary is held until the collector exits, so that other runners can share it meanwhile
+	started := false
+	defer func() {
+		if !started {
+			release()
+		}
+	}()
 
-	r.cmd = exe.CommandContext(ctx, r.options...)
+	r.cmd = cmd
 	if r.cmd.Err != nil {
 		return r.cmd.Err
 	}
+	cgroupDir, err := r.prepareLimits(r.cmd)
+	if err != nil {
+		return err
+	}
+	if cgroupDir != nil {
+		// the cgroup is only needed open until the process is created in it
+		defer cgroupDir.Close()
+	}
 	stderr, err := r.cmd.StderrPipe()
 	if err != nil {
 		return err
 	}
+	if err = r.cmd.Start(); err != nil {
+		r.removeCgroup()
+		return err
+	}
+	errChan := make(chan *StartError, 1)
+	done := make(chan struct{})
+	r.mutex.Lock()
+	r.errChan = errChan
+	r.done = done
+	r.pid = r.cmd.Process.Pid
+	r.mutex.Unlock()
+	started = true
 	go func() {
 		scanner := bufio.NewScanner(stderr)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLogLineSize)
+		// the last lines of this collector, which explain why it exited
+		tail := make([]string, 0, maxErrorLines)
 		for scanner.Scan() {
-			r.state.LastLog = scanner.Text()
-			r.logger.Info("otelcol-contrib", zap.String("policy", r.policyName), zap.String("log", r.state.LastLog))
-			if r.cmd.Err != nil {
-				r.errChan <- r.state.LastLog
+			line := r.secrets.Redact(scanner.Text())
+			r.appendLog(line)
+			if len(tail) == maxErrorLines {
+				tail = tail[1:]
 			}
+			tail = append(tail, line)
+			r.logger.Info("otelcol-contrib", zap.String("policy", r.policyName), zap.String("log", line))
 		}
-	}()
-	if err = r.cmd.Start(); err != nil {
-		return err
-	}
-	go func() {
-		if err := r.cmd.Wait(); err != nil {
-			r.errChan <- r.state.LastLog
-			close(r.errChan)
+		// stderr must be fully read before waiting, as Wait closes the pipe
+		err := r.cmd.Wait()
+		release()
+		r.mutex.Lock()
+		if r.done == done {
+			r.pid = 0
+		}
+		r.mutex.Unlock()
+		limitErr := r.limitError()
+		r.removeCgroup()
+		if err != nil && ctx.Err() == nil {
+			if limitErr != "" {
+				errChan <- &StartError{Phase: PhaseLimits, Cause: limitErr}
+			} else {
+				errChan <- parseStartError(tail)
+			}
 		}
+		close(done)
 	}()
 
-	reg, _ := regexp.Compile("[^a-zA-Z0-9:(), ]+")
-
+	r.mutex.Lock()
 	r.state.startTime = time.Now()
-	ctxTimeout, cancel := context.WithTimeout(r.ctx, 1*time.Second)
+	r.mutex.Unlock()
+	startupTimeout := r.startupTimeout
+	if startupTimeout == 0 {
+		startupTimeout = defaultStartupTimeout
+	}
+	ctxTimeout, cancel := context.WithTimeout(r.ctx, startupTimeout)
 	defer cancel()
 	select {
-	case line := <-r.errChan:
-		return errors.New(string(append([]byte("otelcol-contrib - "), reg.ReplaceAllString(line, "")...)))
+	case startErr := <-errChan:
+		cancelFunc()
+		return startErr
 	case <-ctxTimeout.Done():
 		r.setStatus(Running)
 		r.logger.Info("runner proccess started successfully", zap.String("policy", r.policyName), zap.Any("pid", r.cmd.Process.Pid))
 	}
 
 	go func() {
-		for {
-			select {
-			case line := <-r.errChan:
-				r.state.LastError = string(append([]byte("otelcol-contrib - "), reg.ReplaceAllString(line, "")...))
-				r.setStatus(RunnerError)
-			case <-r.ctx.Done():
-				r.Stop(r.ctx)
-				return
-			}
+		select {
+		case startErr := <-errChan:
+			r.mutex.Lock()
+			r.state.LastError = startErr.Error()
+			r.mutex.Unlock()
+			r.setStatus(RunnerError)
+		case <-ctx.Done():
+			// the runner may have been started again meanwhile, only this start is reported
+			<-done
+			r.transition(Offline, func(s State) bool { return r.done == done && s.Status == Running })
 		}
 	}()
 
 	return nil
 }
 
+// Stop kills the collector process and waits for it to exit.
 func (r *Runner) Stop(ctx context.Context) {
 	r.logger.Info("routine call to stop runner", zap.Any("routine", ctx.Value("routine")))
-	defer r.cancelFunc()
+	if r.cancelFunc != nil {
+		r.cancelFunc()
+	}
+	r.mutex.RLock()
+	done := r.done
+	r.mutex.RUnlock()
+	if done != nil {
+		<-done
+	}
 	r.setStatus(Offline)
 	r.logger.Info("runner process stopped", zap.String("policy", r.policyName))
 }
 
+// Pause stops the collector and keeps the runner configured so that it can be started again.
+func (r *Runner) Pause(ctx context.Context) {
+	r.Stop(ctx)
+	r.setStatus(Paused)
+}
+
+// Restart stops the collector and starts it again, counting the restart in the runner state.
+func (r *Runner) Restart(ctx context.Context, cancelFunc context.CancelFunc) error {
+	r.Stop(ctx)
+	r.mutex.Lock()
+	r.state.RestartCount++
+	r.state.LastRestartTS = time.Now()
+	r.mutex.Unlock()
+	if err := r.Start(ctx, cancelFunc); err != nil {
+		r.mutex.Lock()
+		r.state.LastError = err.Error()
+		r.mutex.Unlock()
+		r.setStatus(RunnerError)
+		return err
+	}
+	return nil
+}
+
 func (r *Runner) GetStatus() State {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
 	return r.state
 }
 
+func (r *Runner) Logs() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	logs := make([]string, len(r.logs))
+	copy(logs, r.logs)
+	return logs
+}
+
+func (r *Runner) appendLog(line string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.state.LastLog = line
+	if len(r.logs) >= maxLogLines {
+		r.logs = r.logs[1:]
+	}
+	r.logs = append(r.logs, line)
+}
+
 func (r *Runner) setStatus(s Status) {
+	r.transition(s, nil)
+}
+
+// transition sets the runner status, if accept is nil or approves the current state, and
+// publishes the change to the events bus.
+func (r *Runner) transition(s Status, accept func(State) bool) {
+	r.mutex.Lock()
+	old := r.state
+	if accept != nil && !accept(old) {
+		r.mutex.Unlock()
+		return
+	}
 	r.state.Status = s
 	r.state.StatusText = MapStatus[s]
+	current := r.state
+	r.mutex.Unlock()
+	if old.Status == current.Status {
+		return
+	}
+	e := events.Event{
+		Type:            events.Status,
+		Policy:          r.policyName,
+		OldStatus:       MapStatus[old.Status],
+		NewStatus:       current.StatusText,
+		RestartCount:    current.RestartCount,
+		LastRestartTime: current.LastRestartTS,
+	}
+	// the last error is kept after recovering, it only belongs to transitions into an error
+	if s == RunnerError {
+		e.Error = current.LastError
+	}
+	r.events.Publish(e)
 }
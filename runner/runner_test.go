@@ -9,8 +9,10 @@ import (
 	"testing"
 
 	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/secrets"
 	"go.uber.org/zap/zaptest"
 	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 const (
@@ -183,7 +185,7 @@ func TestRunnerStartStop(t *testing.T) {
 
 func TestRunnerGetCapabilities(t *testing.T) {
 	//Act
-	caps, err := GetCapabilities()
+	caps, err := GetCapabilities("")
 	if err != nil {
 		t.Errorf(ERROR_MSG, err)
 	}
@@ -199,3 +201,213 @@ func TestRunnerGetCapabilities(t *testing.T) {
 		t.Errorf(ERROR_MSG, err)
 	}
 }
+
+func TestRunnerRender(t *testing.T) {
+	// Arrange
+	policy := &config.Policy{
+		FeatureGates: []string{"gate1"},
+		Set: map[string]string{
+			"set2": "value2",
+			"set1": "value1",
+		},
+		Config: map[string]interface{}{
+			"policy": "value1",
+		},
+		LogLevel: "debug",
+	}
+
+	// Act
+	b, options, err := Render(policy, "policy.yaml", false)
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if string(b) != "policy: value1\n" {
+		t.Errorf("Expected rendered config to be %q, but got %q", "policy: value1\n", string(b))
+	}
+	expectedOptions := []string{"--config", "policy.yaml", "--set=service.telemetry.metrics.level=None",
+		"--set=service.telemetry.logs.level=DEBUG", "--feature-gates", "gate1", "--set=set1=value1", "--set=set2=value2"}
+	if !reflect.DeepEqual(options, expectedOptions) {
+		t.Errorf("Expected options to be %v, but got %v", expectedOptions, options)
+	}
+}
+
+func TestRunnerValidate(t *testing.T) {
+	// Arrange
+	policy := &config.Policy{
+		Config: map[string]interface{}{
+			"invalid": "value1",
+		},
+	}
+
+	// Act
+	err := Validate(TEST_POLICY, POLICY_DIR, policy, false)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an error, but got none")
+	}
+}
+
+func TestComponentsMissing(t *testing.T) {
+	// Arrange
+	caps := []byte("buildinfo:\n  version: 0.1.0\nreceivers:\n  - name: otlp\nexporters:\n  - name: debug\n")
+	policy := &config.Policy{
+		Config: map[string]interface{}{
+			"receivers": map[string]interface{}{
+				"otlp/1": nil,
+				"kafka":  nil,
+			},
+			"exporters": map[string]interface{}{
+				"debug": nil,
+			},
+		},
+	}
+
+	// Act
+	components, err := ParseComponents(caps)
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	missing := components.Missing(policy)
+
+	// Assert
+	if components.Buildinfo.Version != "0.1.0" {
+		t.Errorf("Expected version to be 0.1.0, but got %v", components.Buildinfo.Version)
+	}
+	if !reflect.DeepEqual(missing, []string{"receivers/kafka"}) {
+		t.Errorf("Expected missing to be [receivers/kafka], but got %v", missing)
+	}
+}
+
+func TestComponentsMissingSources(t *testing.T) {
+	// Arrange
+	caps := []byte("receivers:\n  - name: otlp\nprocessors:\n  - name: batch\nexporters:\n  - name: debug\n")
+	policy := &config.Policy{
+		Config: map[string]interface{}{
+			"receivers": map[string]interface{}{"otlp": nil},
+		},
+		Sources: []config.ConfigSource{
+			{URI: "file:/etc/otelcol/base.yaml"},
+			{Config: map[string]interface{}{"exporters": map[string]interface{}{"debug": nil, "kafka": nil}}},
+			{URI: "yaml:processors::filter/drop::error_mode: ignore"},
+		},
+	}
+
+	// Act
+	components, err := ParseComponents(caps)
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	missing := components.Missing(policy)
+
+	// Assert
+	if !reflect.DeepEqual(missing, []string{"exporters/kafka", "processors/filter"}) {
+		t.Errorf("Expected missing to be [exporters/kafka processors/filter], but got %v", missing)
+	}
+	if len(policy.Config) != 1 || len(policy.Sources) != 3 {
+		t.Errorf("Expected the policy to be unchanged, got %v", policy)
+	}
+}
+
+func TestRunnerConfigureSecrets(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	t.Setenv("TEST_SECRET_API_KEY", "s3cr3t")
+	runner := New(logger, TEST_POLICY, POLICY_DIR, false, WithSecrets(secrets.New("", "TEST_SECRET_")))
+	policy := &config.Policy{
+		Config: map[string]interface{}{
+			"key": "${secret:api_key}",
+		},
+	}
+
+	// Act
+	err := runner.Configure(policy)
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	defer os.Remove(runner.policyFile)
+	b, err := os.ReadFile(runner.policyFile)
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if string(b) != "key: s3cr3t\n" {
+		t.Errorf("Expected secret to be resolved in policy file, but got %q", string(b))
+	}
+	info, err := os.Stat(runner.policyFile)
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected policy file mode to be 0600, but got %v", info.Mode().Perm())
+	}
+	if policy.Config["key"] != "${secret:api_key}" {
+		t.Errorf("Expected policy to keep the secret reference, but got %v", policy.Config["key"])
+	}
+
+	// Act secret in set
+	policy.Set = map[string]string{"exporters.otlp.key": "${secret:api_key}"}
+	err = runner.Configure(policy)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an error, but got none")
+	}
+}
+
+func TestRunnerConfigureSources(t *testing.T) {
+	// Arrange
+	logger := zaptest.NewLogger(t)
+	runner := New(logger, TEST_POLICY, POLICY_DIR, true)
+	var policy config.Policy
+	err := yamlv3.Unmarshal([]byte(`config:
+  key: value
+sources:
+  - file:/etc/otelcol/base.yaml
+  - inline: value
+  - env:OTELCOL_CONFIG
+`), &policy)
+	if err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+
+	// Act
+	err = runner.Configure(&policy)
+
+	// Assert
+	if err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	defer runner.removeConfigFiles()
+	if len(runner.sourceFiles) != 1 {
+		t.Fatalf("Expected a file for the inline source, but got %v", runner.sourceFiles)
+	}
+	b, err := os.ReadFile(runner.sourceFiles[0])
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if string(b) != "inline: value\n" {
+		t.Errorf("Expected inline source file to be %q, but got %q", "inline: value\n", string(b))
+	}
+	expectedOptions := []string{"--config", runner.policyFile, "--config", "file:/etc/otelcol/base.yaml",
+		"--config", runner.sourceFiles[0], "--config", "env:OTELCOL_CONFIG"}
+	if !reflect.DeepEqual(runner.options, expectedOptions) {
+		t.Errorf("Expected options to be %v, but got %v", expectedOptions, runner.options)
+	}
+	out, err := yamlv3.Marshal(policy.Sources)
+	if err != nil || string(out) != "- file:/etc/otelcol/base.yaml\n- inline: value\n- env:OTELCOL_CONFIG\n" {
+		t.Errorf("Expected sources to marshal as they were given, but got %q, %v", string(out), err)
+	}
+
+	// Act unsupported source
+	policy.Sources = append(policy.Sources, config.ConfigSource{URI: "s3://bucket/config.yaml"})
+	err = runner.Configure(&policy)
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an error, but got none")
+	}
+}
@@ -0,0 +1,159 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	sourceScheme = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]+:`)
+	envName      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ValidateSource checks that a config source URI uses a scheme the collector resolves without
+// reaching other hosts: an absolute path or file:, env:, yaml:, and http: or https: served by the
+// local host.
+func ValidateSource(s config.ConfigSource) error {
+	if s.Config != nil {
+		return nil
+	}
+	uri := s.URI
+	if uri == "" {
+		return errors.New("config source must not be empty")
+	}
+	if secrets.HasReference(uri) {
+		return fmt.Errorf("secret references are only supported in config, source %s would expose it in the command line", uri)
+	}
+	scheme := strings.TrimSuffix(sourceScheme.FindString(uri), ":")
+	value := strings.TrimPrefix(uri, scheme+":")
+	switch strings.ToLower(scheme) {
+	case "":
+		if !filepath.IsAbs(uri) {
+			return fmt.Errorf("config source %s must be an absolute path or a URI", uri)
+		}
+	case "file":
+		if !filepath.IsAbs(value) {
+			return fmt.Errorf("config source %s must be an absolute path", uri)
+		}
+	case "env":
+		if !envName.MatchString(value) {
+			return fmt.Errorf("config source %s must name an environment variable", uri)
+		}
+	case "yaml":
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("config source %s must hold a YAML snippet", uri)
+		}
+	case "http", "https":
+		u, err := url.Parse(uri)
+		if err != nil {
+			return fmt.Errorf("invalid config source %s: %w", uri, err)
+		}
+		if !isLocalHost(u.Hostname()) {
+			return fmt.Errorf("config source %s must be served by the local host", uri)
+		}
+	default:
+		return fmt.Errorf("unsupported config source scheme %s, use file, env, yaml, http or https", scheme)
+	}
+	return nil
+}
+
+func isLocalHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// MergeSources returns the config of a policy with the sources that hold their config, inline
+// configs and yaml: snippets, merged into it as the collector merges them, and the sources the
+// collector resolves itself, such as files. The policy is left unchanged.
+func MergeSources(p *config.Policy) (map[string]interface{}, []config.ConfigSource, error) {
+	merged, _ := copyValue(p.Config).(map[string]interface{})
+	if merged == nil {
+		merged = make(map[string]interface{})
+	}
+	remaining := make([]config.ConfigSource, 0)
+	for _, s := range p.Sources {
+		source := s.Config
+		if snippet, ok := strings.CutPrefix(s.URI, "yaml:"); ok {
+			var err error
+			if source, err = ParseYAMLSource(snippet); err != nil {
+				return nil, nil, fmt.Errorf("invalid config source %s: %w", s.URI, err)
+			}
+		}
+		if source == nil {
+			remaining = append(remaining, s)
+			continue
+		}
+		mergeConfig(merged, source)
+	}
+	return merged, remaining, nil
+}
+
+// ParseYAMLSource decodes a yaml: snippet, whose keys may be paths separated by ::.
+func ParseYAMLSource(snippet string) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := yaml.Unmarshal([]byte(snippet), &m); err != nil {
+		return nil, err
+	}
+	return expandKeys(m), nil
+}
+
+// expandKeys returns m with its keys::paths expanded into nested maps, as the collector does.
+func expandKeys(m map[string]interface{}) map[string]interface{} {
+	expanded := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if vm, ok := v.(map[string]interface{}); ok {
+			v = expandKeys(vm)
+		}
+		path := strings.Split(k, "::")
+		for i := len(path) - 1; i > 0; i-- {
+			v = map[string]interface{}{path[i]: v}
+		}
+		mergeConfig(expanded, map[string]interface{}{path[0]: v})
+	}
+	return expanded
+}
+
+// mergeConfig merges src into dst as the collector merges its configs: maps are merged key by
+// key and any other value of src replaces the one of dst.
+func mergeConfig(dst map[string]interface{}, src map[string]interface{}) {
+	for k, v := range src {
+		currentMap, currentIsMap := dst[k].(map[string]interface{})
+		if srcMap, ok := v.(map[string]interface{}); ok && currentIsMap {
+			mergeConfig(currentMap, srcMap)
+			continue
+		}
+		dst[k] = copyValue(v)
+	}
+}
+
+// copyValue copies the maps and lists of a YAML value.
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[k] = copyValue(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i, e := range t {
+			l[i] = copyValue(e)
+		}
+		return l
+	default:
+		return v
+	}
+}
@@ -0,0 +1,44 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+)
+
+func TestValidateSource(t *testing.T) {
+	tests := []struct {
+		name  string
+		uri   string
+		valid bool
+	}{
+		{name: "absolute path", uri: "/etc/otelcol/base.yaml", valid: true},
+		{name: "relative path", uri: "base.yaml"},
+		{name: "file", uri: "file:/etc/otelcol/base.yaml", valid: true},
+		{name: "relative file", uri: "file:base.yaml"},
+		{name: "env", uri: "env:OTELCOL_CONFIG", valid: true},
+		{name: "invalid env", uri: "env:OTELCOL-CONFIG"},
+		{name: "yaml", uri: "yaml:processors::batch::timeout: 2s", valid: true},
+		{name: "empty yaml", uri: "yaml: "},
+		{name: "local http", uri: "http://localhost:8080/config.yaml", valid: true},
+		{name: "loopback https", uri: "https://127.0.0.1:8443/config.yaml", valid: true},
+		{name: "remote http", uri: "http://config.example.com/config.yaml"},
+		{name: "unsupported scheme", uri: "s3://bucket/config.yaml"},
+		{name: "secret reference", uri: "yaml:exporters::otlp::headers::key: ${secret:api_key}"},
+		{name: "empty", uri: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			err := ValidateSource(config.ConfigSource{URI: tt.uri})
+
+			// Assert
+			if tt.valid && err != nil {
+				t.Errorf(ERROR_MSG, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("Expected an error for %q, but got none", tt.uri)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package runner
+
+import (
+	"regexp"
+	"strings"
+)
+
+// The phases a collector can fail in.
+const (
+	PhaseConfig  = "config"
+	PhaseBuild   = "build"
+	PhaseStart   = "start"
+	PhaseLimits  = "limits"
+	PhaseUnknown = "unknown"
+)
+
+// maxErrorLines is how many of the last stderr lines of a collector are kept to explain its exit.
+const maxErrorLines = 20
+
+// StartError is why a collector failed to start or exited, parsed from its stderr.
+type StartError struct {
+	// Phase is when the collector failed: config, build, start, limits or unknown
+	Phase string `yaml:"phase" json:"phase"`
+	// Kind is the kind of the failing component: receiver, processor, exporter, connector or extension
+	Kind      string `yaml:"kind,omitempty" json:"kind,omitempty"`
+	Component string `yaml:"component,omitempty" json:"component,omitempty"`
+	Pipeline  string `yaml:"pipeline,omitempty" json:"pipeline,omitempty"`
+	Cause     string `yaml:"cause" json:"cause"`
+	// Line is the collector output the error was parsed from
+	Line string `yaml:"line,omitempty" json:"line,omitempty"`
+}
+
+func (e *StartError) Error() string {
+	var b strings.Builder
+	b.WriteString("otelcol-contrib - " + e.Phase + " error")
+	if e.Kind != "" {
+		b.WriteString(" in " + e.Kind)
+		if e.Component != "" {
+			b.WriteString(" " + e.Component)
+		}
+	}
+	if e.Pipeline != "" {
+		b.WriteString(" of pipeline " + e.Pipeline)
+	}
+	b.WriteString(": " + e.Cause)
+	return b.String()
+}
+
+var (
+	// errorStart matches the line a collector error begins with, as logged by the collector main
+	// or printed by its command
+	errorStart = regexp.MustCompile(`^(?:\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} )?(?:collector server run finished with error: |Error: )`)
+	errorCount = regexp.MustCompile(`^\d+ error\(s\) decoding:\s*`)
+	// phaseWrappers are the messages the collector wraps errors of each phase with
+	phaseWrappers = []struct {
+		prefix string
+		phase  string
+	}{
+		{"failed to get config: ", PhaseConfig},
+		{"cannot resolve the configuration: ", PhaseConfig},
+		{"cannot unmarshal the configuration: ", PhaseConfig},
+		{"invalid configuration: ", PhaseConfig},
+		{"failed to build pipelines: ", PhaseBuild},
+		{"cannot build pipelines: ", PhaseBuild},
+		{"failed to build extensions: ", PhaseBuild},
+		{"cannot start pipelines: ", PhaseStart},
+		{"failed to start extensions: ", PhaseStart},
+		// printed by otlpinf when it cannot apply the open files and nice limits to the collector
+		{"failed to apply policy limits: ", PhaseLimits},
+	}
+	componentPath = regexp.MustCompile(`^(receivers|processors|exporters|connectors|extensions)::([^:\s]+): `)
+	pipelinePath  = regexp.MustCompile(`^(?:service::)?pipelines::([^:\s]+): `)
+	decodingPath  = regexp.MustCompile(`^error decoding '(receivers|processors|exporters|connectors|extensions)': `)
+	componentOp   = regexp.MustCompile(`^failed to (?:start|create|build) "([^"]+)" (receiver|processor|exporter|connector|extension)(?: for data type "[^"]+")?: `)
+	references    = regexp.MustCompile(`references (receiver|processor|exporter|connector|extension) "([^"]+)"`)
+	unknownType   = regexp.MustCompile(`unknown type: "([^"]+)"`)
+	pipelineName  = regexp.MustCompile(`pipeline "([^"]+)"`)
+)
+
+// parseStartError parses the error a collector exited with from the last lines of its stderr.
+func parseStartError(lines []string) *StartError {
+	first := -1
+	for i := len(lines) - 1; i >= 0; i-- {
+		if errorStart.MatchString(lines[i]) {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		// without a recognized error, the last line is the most likely explanation
+		for i := len(lines) - 1; i >= 0; i-- {
+			if strings.TrimSpace(lines[i]) != "" {
+				return &StartError{Phase: PhaseUnknown, Cause: strings.TrimSpace(lines[i]), Line: lines[i]}
+			}
+		}
+		return &StartError{Phase: PhaseUnknown, Cause: "collector exited without output"}
+	}
+
+	raw := make([]string, 0, len(lines)-first)
+	for _, l := range lines[first:] {
+		if strings.TrimSpace(l) != "" {
+			raw = append(raw, l)
+		}
+	}
+	msg := errorStart.ReplaceAllString(raw[0], "")
+	if len(raw) > 1 {
+		details := make([]string, 0, len(raw)-1)
+		for _, l := range raw[1:] {
+			details = append(details, strings.TrimPrefix(strings.TrimSpace(l), "* "))
+		}
+		msg += " " + strings.Join(details, "; ")
+	}
+
+	e := &StartError{Phase: PhaseUnknown, Line: strings.Join(raw, "\n")}
+	for unwrapped := true; unwrapped; {
+		unwrapped = false
+		for _, w := range phaseWrappers {
+			if rest, ok := strings.CutPrefix(msg, w.prefix); ok {
+				msg, unwrapped = rest, true
+				if e.Phase == PhaseUnknown {
+					e.Phase = w.phase
+				}
+			}
+		}
+		if loc := errorCount.FindStringIndex(msg); loc != nil {
+			msg, unwrapped = msg[loc[1]:], true
+		}
+		if m := pipelinePath.FindStringSubmatch(msg); m != nil {
+			e.Pipeline = m[1]
+			msg, unwrapped = msg[len(m[0]):], true
+		}
+		if m := componentPath.FindStringSubmatch(msg); m != nil {
+			e.Kind, e.Component = strings.TrimSuffix(m[1], "s"), m[2]
+			msg, unwrapped = msg[len(m[0]):], true
+		}
+		if m := decodingPath.FindStringSubmatch(msg); m != nil {
+			e.Kind = strings.TrimSuffix(m[1], "s")
+			msg, unwrapped = msg[len(m[0]):], true
+		}
+		if m := componentOp.FindStringSubmatch(msg); m != nil {
+			e.Kind, e.Component = m[2], m[1]
+			msg, unwrapped = msg[len(m[0]):], true
+		}
+	}
+	if m := references.FindStringSubmatch(msg); m != nil && e.Component == "" {
+		e.Kind, e.Component = m[1], m[2]
+	}
+	if m := unknownType.FindStringSubmatch(msg); m != nil && e.Component == "" {
+		e.Component = m[1]
+	}
+	if m := pipelineName.FindStringSubmatch(msg); m != nil && e.Pipeline == "" {
+		e.Pipeline = m[1]
+	}
+	e.Cause = msg
+	return e
+}
@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestParseStartError(t *testing.T) {
+	// Arrange
+	tests := []struct {
+		lines    []string
+		expected StartError
+	}{
+		{
+			[]string{"2024/01/01 00:00:00 collector server run finished with error: cannot start pipelines: failed to start \"otlp\" receiver: listen tcp 0.0.0.0:4318: bind: address already in use"},
+			StartError{Phase: PhaseStart, Kind: "receiver", Component: "otlp", Cause: "listen tcp 0.0.0.0:4318: bind: address already in use"},
+		},
+		{
+			[]string{"Error: invalid configuration: exporters::otlp/backend: must have endpoint"},
+			StartError{Phase: PhaseConfig, Kind: "exporter", Component: "otlp/backend", Cause: "must have endpoint"},
+		},
+		{
+			[]string{"Error: invalid configuration: service::pipelines::traces/app: references processor \"batch\" which is not configured"},
+			StartError{Phase: PhaseConfig, Kind: "processor", Component: "batch", Pipeline: "traces/app", Cause: "references processor \"batch\" which is not configured"},
+		},
+		{
+			[]string{"info\tstarting", "Error: failed to get config: cannot unmarshal the configuration: 1 error(s) decoding:", "", "* error decoding 'receivers': unknown type: \"foo\" for id: \"foo\""},
+			StartError{Phase: PhaseConfig, Kind: "receiver", Component: "foo", Cause: "unknown type: \"foo\" for id: \"foo\""},
+		},
+		{
+			[]string{"Error: failed to build pipelines: failed to create \"file\" exporter for data type \"logs\": open /var/log/otel/out.json: permission denied"},
+			StartError{Phase: PhaseBuild, Kind: "exporter", Component: "file", Cause: "open /var/log/otel/out.json: permission denied"},
+		},
+		{
+			[]string{"Error: failed to apply policy limits: failed to set nice value: permission denied"},
+			StartError{Phase: PhaseLimits, Cause: "failed to set nice value: permission denied"},
+		},
+		{
+			[]string{"info\tstarting", "panic: runtime error", ""},
+			StartError{Phase: PhaseUnknown, Cause: "panic: runtime error"},
+		},
+	}
+
+	for i, test := range tests {
+		// Act
+		e := parseStartError(test.lines)
+		e.Line = ""
+
+		// Assert
+		if *e != test.expected {
+			t.Errorf("Expected lines %d to be parsed as %+v, got %+v", i, test.expected, *e)
+		}
+	}
+}
+
+func TestRunnerStartError(t *testing.T) {
+	// Arrange
+	r := New(zaptest.NewLogger(t), TEST_POLICY, POLICY_DIR, false)
+	err := r.Configure(&config.Policy{Config: map[string]interface{}{"invalid": "key"}})
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+
+	// Act
+	ctx, cancel := context.WithCancel(context.Background())
+	err = r.Start(ctx, cancel)
+	r.Stop(ctx)
+
+	// Assert
+	var startErr *StartError
+	if !errors.As(err, &startErr) {
+		t.Fatalf("Expected a start error, but got %v", err)
+	}
+	if startErr.Phase != PhaseConfig || !strings.Contains(startErr.Line, "collector server run finished with error") {
+		t.Errorf("Expected a config error with its collector output, got %+v", startErr)
+	}
+}
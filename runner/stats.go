@@ -0,0 +1,26 @@
+package runner
+
+import "errors"
+
+// ErrNotRunning is returned when statistics are requested for a runner without a collector process.
+var ErrNotRunning = errors.New("collector process is not running")
+
+// ProcessStats are the resources used by a collector process.
+type ProcessStats struct {
+	PID        int     `yaml:"pid" json:"pid"`
+	CPUSeconds float64 `yaml:"cpu_seconds" json:"cpu_seconds"`
+	RSSBytes   uint64  `yaml:"rss_bytes" json:"rss_bytes"`
+	OpenFDs    int     `yaml:"open_fds" json:"open_fds"`
+	Threads    int     `yaml:"threads" json:"threads"`
+}
+
+// Stats returns the resources used by the collector process of the runner.
+func (r *Runner) Stats() (ProcessStats, error) {
+	r.mutex.RLock()
+	pid := r.pid
+	r.mutex.RUnlock()
+	if pid == 0 {
+		return ProcessStats{}, ErrNotRunning
+	}
+	return processStats(pid)
+}
@@ -0,0 +1,60 @@
+//go:build linux
+
+package runner
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is the USER_HZ unit of the CPU times in /proc, fixed to 100 on every architecture
+// Linux supports.
+const clockTicks = 100
+
+func processStats(pid int) (ProcessStats, error) {
+	dir := "/proc/" + strconv.Itoa(pid)
+	b, err := os.ReadFile(dir + "/stat")
+	if err != nil {
+		return ProcessStats{}, err
+	}
+	stats, err := parseStat(string(b))
+	if err != nil {
+		return ProcessStats{}, err
+	}
+	stats.PID = pid
+	fds, err := os.ReadDir(dir + "/fd")
+	if err != nil {
+		return ProcessStats{}, err
+	}
+	stats.OpenFDs = len(fds)
+	return stats, nil
+}
+
+// parseStat reads the CPU time, resident memory and threads of a /proc/<pid>/stat line.
+func parseStat(stat string) (ProcessStats, error) {
+	// the command name between parentheses may contain spaces, fields are counted after it
+	i := strings.LastIndexByte(stat, ')')
+	if i < 0 {
+		return ProcessStats{}, fmt.Errorf("invalid process stat %q", stat)
+	}
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) < 22 {
+		return ProcessStats{}, fmt.Errorf("invalid process stat %q", stat)
+	}
+	values := make(map[int]uint64, 4)
+	// utime, stime, num_threads and rss are the fields 14, 15, 20 and 24 of proc(5)
+	for _, f := range []int{14, 15, 20, 24} {
+		v, err := strconv.ParseUint(fields[f-3], 10, 64)
+		if err != nil {
+			return ProcessStats{}, fmt.Errorf("invalid process stat field %d: %w", f, err)
+		}
+		values[f] = v
+	}
+	return ProcessStats{
+		CPUSeconds: float64(values[14]+values[15]) / clockTicks,
+		Threads:    int(values[20]),
+		RSSBytes:   values[24] * uint64(os.Getpagesize()),
+	}, nil
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package runner
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestParseStat(t *testing.T) {
+	// Arrange
+	stat := "42 (otelcol contrib) S 1 42 42 0 -1 4194304 83 0 0 0 250 150 0 0 20 0 12 0 211235 2703360 313 18446744073709551615 0"
+
+	// Act
+	stats, err := parseStat(stat)
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if stats.CPUSeconds != 4 || stats.Threads != 12 || stats.RSSBytes != 313*uint64(os.Getpagesize()) {
+		t.Errorf("Expected 4 cpu seconds, 12 threads and 313 pages, got %+v", stats)
+	}
+
+	// Act
+	_, err = parseStat("42 (otelcol")
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an invalid stat error, but got none")
+	}
+}
+
+func TestRunnerStats(t *testing.T) {
+	// Arrange
+	r := New(zaptest.NewLogger(t), TEST_POLICY, POLICY_DIR, false)
+	if err := r.Configure(&config.Policy{Config: map[string]interface{}{"policy": "value1"}}); err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+
+	// Act
+	_, err := r.Stats()
+
+	// Assert
+	if err != ErrNotRunning {
+		t.Errorf("Expected not running error, but got %v", err)
+	}
+
+	// Act
+	ctx, cancel := context.WithCancel(context.Background())
+	if err = r.Start(ctx, cancel); err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	stats, err := r.Stats()
+	r.Stop(ctx)
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	if stats.PID == 0 || stats.RSSBytes == 0 || stats.Threads == 0 || stats.OpenFDs == 0 {
+		t.Errorf("Expected collector process stats, got %+v", stats)
+	}
+	if _, err = r.Stats(); err != ErrNotRunning {
+		t.Errorf("Expected not running error after stop, but got %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package runner
+
+import "errors"
+
+func processStats(pid int) (ProcessStats, error) {
+	return ProcessStats{}, errors.New("process statistics are only available on linux")
+}
@@ -0,0 +1,134 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const Redacted = "<redacted>"
+
+var (
+	reference = regexp.MustCompile(`\$\{secret:([A-Za-z0-9_.-]+)\}`)
+	validName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// Store resolves `${secret:name}` references from files named after the secret in a directory
+// or, when there is no such file, from environment variables named envPrefix + NAME. It keeps
+// track of every resolved value so that it can be redacted from logs and API responses.
+type Store struct {
+	dir       string
+	envPrefix string
+	mutex     sync.RWMutex
+	resolved  map[string]struct{}
+}
+
+func New(dir string, envPrefix string) *Store {
+	return &Store{dir: dir, envPrefix: envPrefix, resolved: make(map[string]struct{})}
+}
+
+// HasReference reports whether s contains a secret reference.
+func HasReference(s string) bool {
+	return reference.MatchString(s)
+}
+
+func (s *Store) Get(name string) (string, error) {
+	if !validName.MatchString(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	if s.dir != "" {
+		b, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err == nil {
+			return s.remember(strings.TrimRight(string(b), "\r\n")), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	if s.envPrefix != "" {
+		env := s.envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(name))
+		if v, ok := os.LookupEnv(env); ok {
+			return s.remember(v), nil
+		}
+	}
+	return "", fmt.Errorf("secret %q not found", name)
+}
+
+func (s *Store) remember(value string) string {
+	if value != "" {
+		s.mutex.Lock()
+		s.resolved[value] = struct{}{}
+		s.mutex.Unlock()
+	}
+	return value
+}
+
+// ResolveString replaces every secret reference in str by its value.
+func (s *Store) ResolveString(str string) (string, error) {
+	var err error
+	ret := reference.ReplaceAllStringFunc(str, func(m string) string {
+		v, e := s.Get(reference.FindStringSubmatch(m)[1])
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	})
+	return ret, err
+}
+
+// Resolve returns a copy of v, a value decoded from YAML, with its secret references resolved.
+func (s *Store) Resolve(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		return s.ResolveString(t)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			var err error
+			if m[k], err = s.Resolve(e); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i, e := range t {
+			var err error
+			if l[i], err = s.Resolve(e); err != nil {
+				return nil, err
+			}
+		}
+		return l, nil
+	default:
+		return v, nil
+	}
+}
+
+// Redact replaces every secret value resolved so far in str. Longer values are replaced first,
+// so that a value containing another one is redacted whole.
+func (s *Store) Redact(str string) string {
+	if s == nil {
+		return str
+	}
+	s.mutex.RLock()
+	values := make([]string, 0, len(s.resolved))
+	for v := range s.resolved {
+		values = append(values, v)
+	}
+	s.mutex.RUnlock()
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+	for _, v := range values {
+		str = strings.ReplaceAll(str, v, Redacted)
+	}
+	return str
+}
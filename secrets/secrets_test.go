@@ -0,0 +1,98 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const ERROR_MSG = "Expected no error, but got %v"
+
+func TestStoreResolve(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file_key"), []byte("from-file\n"), 0o600); err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	t.Setenv("TEST_SECRET_ENV_KEY", "from-env")
+	store := New(dir, "TEST_SECRET_")
+	config := map[string]interface{}{
+		"exporters": map[string]interface{}{
+			"otlp": map[string]interface{}{
+				"headers": []interface{}{"Bearer ${secret:file_key}", "${secret:env-key}"},
+				"other":   "${env:KEEP}",
+			},
+		},
+	}
+
+	// Act
+	resolved, err := store.Resolve(config)
+
+	// Assert
+	if err != nil {
+		t.Errorf(ERROR_MSG, err)
+	}
+	otlp := resolved.(map[string]interface{})["exporters"].(map[string]interface{})["otlp"].(map[string]interface{})
+	headers := otlp["headers"].([]interface{})
+	if headers[0] != "Bearer from-file" || headers[1] != "from-env" {
+		t.Errorf("Expected secrets to be resolved, got %v", headers)
+	}
+	if otlp["other"] != "${env:KEEP}" {
+		t.Errorf("Expected other references to be kept, got %v", otlp["other"])
+	}
+	if !strings.Contains(config["exporters"].(map[string]interface{})["otlp"].(map[string]interface{})["headers"].([]interface{})[0].(string), "${secret:file_key}") {
+		t.Errorf("Expected original config to be unchanged")
+	}
+
+	// Act redact
+	redacted := store.Redact("sending with from-file and from-env")
+
+	// Assert
+	if redacted != "sending with "+Redacted+" and "+Redacted {
+		t.Errorf("Expected secret values to be redacted, got %s", redacted)
+	}
+}
+
+func TestStoreRedactOverlappingValues(t *testing.T) {
+	// Arrange
+	t.Setenv("TEST_SECRET_SHORT", "token")
+	t.Setenv("TEST_SECRET_LONG", "token-with-suffix")
+	store := New("", "TEST_SECRET_")
+	for _, name := range []string{"short", "long"} {
+		if _, err := store.Get(name); err != nil {
+			t.Fatalf(ERROR_MSG, err)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		// Act
+		redacted := store.Redact("auth token-with-suffix")
+
+		// Assert
+		if redacted != "auth "+Redacted {
+			t.Fatalf("Expected the longer secret to be redacted whole, got %s", redacted)
+		}
+	}
+}
+
+func TestStoreGetError(t *testing.T) {
+	// Arrange
+	store := New(t.TempDir(), "TEST_SECRET_")
+
+	// Act
+	_, err := store.ResolveString("${secret:missing}")
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("Expected a not found error, but got %v", err)
+	}
+
+	// Act
+	_, err = store.Get("../passwd")
+
+	// Assert
+	if err == nil || !strings.Contains(err.Error(), "invalid secret name") {
+		t.Errorf("Expected an invalid name error, but got %v", err)
+	}
+}
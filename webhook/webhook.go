@@ -0,0 +1,256 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/events"
+	"github.com/leoparente/opentelemetry-infinity/runner"
+	"go.uber.org/zap"
+)
+
+// Triggers a webhook can be notified of.
+const (
+	Failure   = "failure"
+	CrashLoop = "crash_loop"
+	Recovery  = "recovery"
+	Deleted   = "deleted"
+)
+
+const (
+	SignatureHeader = "X-Otlpinf-Signature"
+
+	defaultTimeout           = 10 * time.Second
+	defaultMaxRetries        = 3
+	defaultBackoff           = time.Second
+	defaultCrashLoopFailures = 3
+	defaultCrashLoopWindow   = 10 * time.Minute
+	// queueSize is the number of notifications waiting for delivery per webhook, newer ones
+	// are dropped while it is full.
+	queueSize = 100
+)
+
+var knownTriggers = map[string]bool{Failure: true, CrashLoop: true, Recovery: true, Deleted: true}
+
+// Payload is the JSON body posted to webhooks.
+type Payload struct {
+	Trigger   string       `json:"trigger"`
+	Policy    string       `json:"policy"`
+	Timestamp time.Time    `json:"timestamp"`
+	State     runner.State `json:"state"`
+}
+
+type endpoint struct {
+	conf     config.WebhookConfig
+	triggers map[string]bool
+	policies map[string]bool
+	queue    chan Payload
+}
+
+// Notifier turns policy events into webhook notifications.
+type Notifier struct {
+	logger    *zap.Logger
+	client    *http.Client
+	endpoints []*endpoint
+	crashLoop config.CrashLoopConfig
+	failures  map[string][]time.Time
+}
+
+func New(logger *zap.Logger, webhooks []config.WebhookConfig, crashLoop config.CrashLoopConfig) (*Notifier, error) {
+	if crashLoop.Failures <= 0 {
+		crashLoop.Failures = defaultCrashLoopFailures
+	}
+	if crashLoop.Window <= 0 {
+		crashLoop.Window = defaultCrashLoopWindow
+	}
+	n := &Notifier{logger: logger, client: &http.Client{}, crashLoop: crashLoop, failures: make(map[string][]time.Time)}
+	for i, c := range webhooks {
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook %d: invalid url %q", i, c.URL)
+		}
+		if c.Timeout <= 0 {
+			c.Timeout = defaultTimeout
+		}
+		if c.MaxRetries < 0 {
+			c.MaxRetries = 0
+		} else if c.MaxRetries == 0 {
+			c.MaxRetries = defaultMaxRetries
+		}
+		if c.Backoff <= 0 {
+			c.Backoff = defaultBackoff
+		}
+		ep := &endpoint{conf: c, triggers: make(map[string]bool), policies: make(map[string]bool), queue: make(chan Payload, queueSize)}
+		for _, t := range c.Triggers {
+			if !knownTriggers[t] {
+				return nil, fmt.Errorf("webhook %d: unknown trigger %q, use failure, crash_loop, recovery or deleted", i, t)
+			}
+			ep.triggers[t] = true
+		}
+		if len(ep.triggers) == 0 {
+			for t := range knownTriggers {
+				ep.triggers[t] = true
+			}
+		}
+		for _, p := range c.Policies {
+			ep.policies[p] = true
+		}
+		n.endpoints = append(n.endpoints, ep)
+	}
+	return n, nil
+}
+
+// Start subscribes to bus and delivers notifications until ctx is done.
+func (n *Notifier) Start(ctx context.Context, bus *events.Bus) {
+	sub := bus.Subscribe()
+	for _, ep := range n.endpoints {
+		go n.deliver(ctx, ep)
+	}
+	go func() {
+		defer sub.Close()
+		for {
+			select {
+			case e := <-sub.Events():
+				n.notify(e)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// triggers returns the triggers fired by an event.
+func (n *Notifier) triggers(e events.Event) []string {
+	failed := runner.MapStatus[runner.RunnerError]
+	switch {
+	case e.Type == events.Deleted:
+		delete(n.failures, e.Policy)
+		return []string{Deleted}
+	case e.Type != events.Status:
+		return nil
+	case e.NewStatus == failed:
+		ret := []string{Failure}
+		since := e.Timestamp.Add(-n.crashLoop.Window)
+		failures := []time.Time{e.Timestamp}
+		for _, t := range n.failures[e.Policy] {
+			if t.After(since) {
+				failures = append(failures, t)
+			}
+		}
+		n.failures[e.Policy] = failures
+		if len(failures) >= n.crashLoop.Failures {
+			ret = append(ret, CrashLoop)
+			delete(n.failures, e.Policy)
+		}
+		return ret
+	case e.OldStatus == failed && e.NewStatus == runner.MapStatus[runner.Running]:
+		return []string{Recovery}
+	}
+	return nil
+}
+
+func (n *Notifier) notify(e events.Event) {
+	for _, t := range n.triggers(e) {
+		p := Payload{
+			Trigger:   t,
+			Policy:    e.Policy,
+			Timestamp: e.Timestamp,
+			State: runner.State{
+				StatusText:    e.NewStatus,
+				RestartCount:  e.RestartCount,
+				LastError:     e.Error,
+				LastRestartTS: e.LastRestartTime,
+			},
+		}
+		for _, ep := range n.endpoints {
+			if !ep.triggers[t] || (len(ep.policies) > 0 && !ep.policies[e.Policy]) {
+				continue
+			}
+			select {
+			case ep.queue <- p:
+			default:
+				n.logger.Warn("webhook queue is full, dropping notification", zap.String("url", ep.conf.URL),
+					zap.String("trigger", t), zap.String("policy", e.Policy))
+			}
+		}
+	}
+}
+
+func (n *Notifier) deliver(ctx context.Context, ep *endpoint) {
+	for {
+		select {
+		case p := <-ep.queue:
+			if err := n.send(ctx, ep, p); err != nil {
+				n.logger.Error("failed to deliver webhook", zap.String("url", ep.conf.URL),
+					zap.String("trigger", p.Trigger), zap.String("policy", p.Policy), zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// send posts p, retrying with an exponential backoff on connection errors and on 429 and 5xx
+// responses.
+func (n *Notifier) send(ctx context.Context, ep *endpoint, p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	backoff := ep.conf.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(ctx, ep, body)
+		if err == nil || !retry || attempt >= ep.conf.MaxRetries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, ep *endpoint, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ep.conf.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range ep.conf.Headers {
+		req.Header.Set(k, v)
+	}
+	if ep.conf.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(ep.conf.Secret, body))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		return retry, fmt.Errorf("webhook replied %s", resp.Status)
+	}
+	return false, nil
+}
+
+// Sign returns the signature of body sent in the SignatureHeader: `sha256=` followed by the hex
+// encoded HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
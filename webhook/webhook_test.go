@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/leoparente/opentelemetry-infinity/config"
+	"github.com/leoparente/opentelemetry-infinity/events"
+	"go.uber.org/zap/zaptest"
+)
+
+const (
+	ERROR_MSG   = "Expected no error, but got %v"
+	TEST_POLICY = "test-policy"
+	TEST_SECRET = "secret"
+)
+
+func TestNotifierTriggers(t *testing.T) {
+	// Arrange
+	n, err := New(zaptest.NewLogger(t), nil, config.CrashLoopConfig{Failures: 2, Window: time.Minute})
+	if err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	now := time.Now()
+	tests := []struct {
+		event    events.Event
+		expected []string
+	}{
+		{events.Event{Type: events.Status, OldStatus: "unknown", NewStatus: "running", Timestamp: now}, nil},
+		{events.Event{Type: events.Status, OldStatus: "running", NewStatus: "runner_error", Timestamp: now}, []string{Failure}},
+		{events.Event{Type: events.Status, OldStatus: "runner_error", NewStatus: "running", Timestamp: now}, []string{Recovery}},
+		{events.Event{Type: events.Status, OldStatus: "running", NewStatus: "runner_error", Timestamp: now}, []string{Failure, CrashLoop}},
+		{events.Event{Type: events.Status, OldStatus: "running", NewStatus: "runner_error", Timestamp: now.Add(2 * time.Minute)}, []string{Failure}},
+		{events.Event{Type: events.Deleted, NewStatus: "offline", Timestamp: now}, []string{Deleted}},
+	}
+
+	for i, test := range tests {
+		// Act
+		test.event.Policy = TEST_POLICY
+		triggers := n.triggers(test.event)
+
+		// Assert
+		if !reflect.DeepEqual(triggers, test.expected) {
+			t.Errorf("Expected event %d to trigger %v, got %v", i, test.expected, triggers)
+		}
+	}
+}
+
+func TestNotifierDelivery(t *testing.T) {
+	// Arrange
+	var mutex sync.Mutex
+	attempts := 0
+	received := make(chan Payload, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts++
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign(TEST_SECRET, body) || r.Header.Get("X-Team") != "payments" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// the first delivery fails to check it is retried
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf(ERROR_MSG, err)
+		}
+		received <- p
+	}))
+	defer srv.Close()
+
+	n, err := New(zaptest.NewLogger(t), []config.WebhookConfig{{
+		URL:      srv.URL,
+		Headers:  map[string]string{"X-Team": "payments"},
+		Secret:   TEST_SECRET,
+		Triggers: []string{Failure},
+		Backoff:  10 * time.Millisecond,
+	}}, config.CrashLoopConfig{})
+	if err != nil {
+		t.Fatalf(ERROR_MSG, err)
+	}
+	bus := events.NewBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n.Start(ctx, bus)
+
+	// Act
+	bus.Publish(events.Event{Type: events.Deleted, Policy: TEST_POLICY})
+	bus.Publish(events.Event{Type: events.Status, Policy: TEST_POLICY, OldStatus: "running", NewStatus: "runner_error",
+		Error: "otelcol-contrib - failed", RestartCount: 2})
+
+	// Assert
+	select {
+	case p := <-received:
+		if p.Trigger != Failure || p.Policy != TEST_POLICY || p.State.LastError != "otelcol-contrib - failed" || p.State.RestartCount != 2 {
+			t.Errorf("Expected failure payload of %s, got %+v", TEST_POLICY, p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected webhook to be delivered")
+	}
+	mutex.Lock()
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %v", attempts)
+	}
+	mutex.Unlock()
+}
+
+func TestNewInvalidWebhook(t *testing.T) {
+	// Act
+	_, err := New(zaptest.NewLogger(t), []config.WebhookConfig{{URL: "ftp://example.com"}}, config.CrashLoopConfig{})
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an invalid url error, but got none")
+	}
+
+	// Act
+	_, err = New(zaptest.NewLogger(t), []config.WebhookConfig{{URL: "http://example.com", Triggers: []string{"crash"}}}, config.CrashLoopConfig{})
+
+	// Assert
+	if err == nil {
+		t.Errorf("Expected an unknown trigger error, but got none")
+	}
+}